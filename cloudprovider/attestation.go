@@ -0,0 +1,83 @@
+package cloudprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const AttestationBundleVersion = 1
+
+type AttestationFormat string
+
+const (
+	// Document is the instance identity document, Signature its base64 RSA SHA-256 signature.
+	// The document holds no nonce, the bundle proves the identity but not that it is fresh.
+	// Anyone who has seen a bundle can replay it, attestation_verifier rejects the format unless
+	// Options.AllowUnboundAWS is set
+	AttestationFormat_AWSIdentityDocument AttestationFormat = "aws-identity-document"
+	// Signature is the base64 PKCS #7 attested document, its nonce is derived from the bundle nonce
+	AttestationFormat_AzureAttestedDocument AttestationFormat = "azure-attested-document"
+	// Signature is the GCE identity token (RS256 JWT) issued with the nonce as audience
+	AttestationFormat_GCPIdentityToken AttestationFormat = "gcp-identity-token"
+	// Document is signed with the machine's configured key, PublicKey holds the key
+	AttestationFormat_LocalKey AttestationFormat = "local-key"
+)
+
+// Proof that a machine answered a nonce, produced by Attest and serialized as JSON.
+// The server side validates it offline with the attestation_verifier package
+type AttestationBundle struct {
+	Version    int               `json:"version"`
+	Provider   CloudProviderType `json:"provider"`
+	Format     AttestationFormat `json:"format"`
+	Nonce      string            `json:"nonce"`
+	InstanceID string            `json:"instance_id"` // the id the document attests: EC2 instance id, Azure vmId, GCE instance id
+	CreatedAt  time.Time         `json:"created_at"`
+	Document   []byte            `json:"document,omitempty"` // the signed content, for formats that sign a separate document
+	Signature  string            `json:"signature"`
+	PublicKey  []byte            `json:"public_key,omitempty"` // PKIX DER of the signing key, local keys only
+}
+
+// Decodes a bundle produced by json.Marshal
+func ParseAttestationBundle(data []byte) (*AttestationBundle, error) {
+	bundle := &AttestationBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation bundle: %v", ErrInvalidSignature, err)
+	}
+	if bundle.Version < 1 || bundle.Version > AttestationBundleVersion {
+		return nil, fmt.Errorf("%w: unsupported attestation bundle version %v", ErrInvalidConfig, bundle.Version)
+	}
+	return bundle, nil
+}
+
+// Implemented by providers that can prove the identity of the machine
+type IAttester interface {
+	ICloudProviderVirtualMachine
+	// The provider must be initialized, nonce is chosen by the verifying party
+	AttestIdentity(ctx context.Context, nonce string) (*AttestationBundle, error)
+}
+
+// Uses the provider's AttestIdentity, ErrUnimplemented if it has none
+func Attest(ctx context.Context, provider ICloudProviderVirtualMachine, nonce string) (*AttestationBundle, error) {
+	attester, ok := provider.(IAttester)
+	if !ok {
+		return nil, fmt.Errorf("%v attestation: %w", provider.GetName(), ErrUnimplemented)
+	}
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: empty attestation nonce", ErrInvalidConfig)
+	}
+	return attester.AttestIdentity(ctx, nonce)
+}
+
+// Fills the fields common to all bundles
+func NewAttestationBundle(provider CloudProviderType, format AttestationFormat, nonce string, instanceID string) *AttestationBundle {
+	return &AttestationBundle{
+		Version:    AttestationBundleVersion,
+		Provider:   provider,
+		Format:     format,
+		Nonce:      nonce,
+		InstanceID: instanceID,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
@@ -0,0 +1,150 @@
+package cloudprovider
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultSysfsRoot = "/sys"
+
+	// /sys/block/<name>/size is always in 512 byte units, regardless of the logical block size
+	sysfsSectorSize = 512
+)
+
+var nvmeNamespaceName = regexp.MustCompile(`^nvme\d+n(\d+)$`)
+
+type BlockDevice struct {
+	Name              string `json:"name" yaml:"name" desc:"Kernel name, e.g. nvme0n1"`
+	Path              string `json:"path" yaml:"path" desc:"Device node"`
+	Model             string `json:"model" yaml:"model" desc:"Device model as reported by the device"`
+	Serial            string `json:"serial" yaml:"serial" desc:"Device serial number, if reported"`
+	SizeBytes         uint64 `json:"size_bytes" yaml:"size_bytes" desc:"Capacity in bytes"`
+	Rotational        bool   `json:"rotational" yaml:"rotational" desc:"True for spinning disks"`
+	LogicalBlockSize  int    `json:"logical_block_size" yaml:"logical_block_size" desc:"Logical block size in bytes"`
+	PhysicalBlockSize int    `json:"physical_block_size" yaml:"physical_block_size" desc:"Physical block size in bytes"`
+	NVMeNamespace     int    `json:"nvme_namespace,omitempty" yaml:"nvme_namespace,omitempty" desc:"NVMe namespace id, 0 for other devices"`
+}
+
+func (device *BlockDevice) IsNVMe() bool {
+	return device.NVMeNamespace != 0
+}
+
+func (device *BlockDevice) String() string {
+	return fmt.Sprintf(`{%v  Model: %v  Serial: %v  Size: %v}`, device.Name, device.Model, device.Serial, device.SizeBytes)
+}
+
+// Enumerates the local disks of the host from <sysfsRoot>/block.
+// Virtual devices without a backing device (loop, dm, md, zram, ...) and empty drives are skipped
+func ReadBlockDevices(sysfsRoot string) ([]BlockDevice, error) {
+	blockDir := filepath.Join(sysfsRoot, "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []BlockDevice{}
+	for _, entry := range entries {
+		dir := filepath.Join(blockDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+		device := readBlockDevice(dir, entry.Name())
+		if device.SizeBytes == 0 {
+			continue
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices, nil
+}
+
+var sysfsRoot = struct {
+	sync.RWMutex
+	path string
+}{path: DefaultSysfsRoot}
+
+// Where GetBlockDevices and the providers' MachineInfo read sysfs from, e.g. /host/sys when the
+// host's sysfs is mounted into a container, or a test fixture. "" restores DefaultSysfsRoot
+func SetSysfsRoot(root string) {
+	if root == "" {
+		root = DefaultSysfsRoot
+	}
+	sysfsRoot.Lock()
+	defer sysfsRoot.Unlock()
+	sysfsRoot.path = root
+}
+
+func SysfsRoot() string {
+	sysfsRoot.RLock()
+	defer sysfsRoot.RUnlock()
+	return sysfsRoot.path
+}
+
+// Returns the disks of this host, nil if sysfs is not available
+func GetBlockDevices() []BlockDevice {
+	devices, _ := ReadBlockDevices(SysfsRoot())
+	return devices
+}
+
+func readBlockDevice(dir string, name string) BlockDevice {
+	device := BlockDevice{
+		Name:              name,
+		Path:              "/dev/" + name,
+		Model:             readSysfsString(filepath.Join(dir, "device", "model")),
+		Serial:            readSysfsString(filepath.Join(dir, "device", "serial")),
+		SizeBytes:         uint64(readSysfsInt(filepath.Join(dir, "size"))) * sysfsSectorSize,
+		Rotational:        readSysfsInt(filepath.Join(dir, "queue", "rotational")) == 1,
+		LogicalBlockSize:  int(readSysfsInt(filepath.Join(dir, "queue", "logical_block_size"))),
+		PhysicalBlockSize: int(readSysfsInt(filepath.Join(dir, "queue", "physical_block_size"))),
+	}
+	if device.Serial == "" {
+		// SCSI devices report the serial in the unit serial number VPD page
+		device.Serial = readVPDSerial(filepath.Join(dir, "device", "vpd_pg80"))
+	}
+	if match := nvmeNamespaceName.FindStringSubmatch(name); match != nil {
+		// nsid is missing on older kernels, the name carries the namespace id as well
+		if nsid := readSysfsInt(filepath.Join(dir, "nsid")); nsid > 0 {
+			device.NVMeNamespace = int(nsid)
+		} else {
+			device.NVMeNamespace, _ = strconv.Atoi(match[1])
+		}
+	}
+	return device
+}
+
+func readSysfsString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func readSysfsInt(path string) int64 {
+	value, err := strconv.ParseInt(readSysfsString(path), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// Page 0x80: 4 bytes header with the page length in bytes 2-3, followed by the serial
+func readVPDSerial(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil || len(content) < 4 || content[1] != 0x80 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(content[2:4]))
+	if len(content) < 4+length {
+		length = len(content) - 4
+	}
+	return strings.TrimSpace(string(content[4 : 4+length]))
+}
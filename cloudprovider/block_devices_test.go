@@ -0,0 +1,92 @@
+package cloudprovider
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeSysfsFixture(t *testing.T, devices map[string]map[string]string) string {
+	root := t.TempDir()
+	for name, files := range devices {
+		for file, value := range files {
+			path := filepath.Join(root, "block", name, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func TestReadBlockDevices(t *testing.T) {
+	root := writeSysfsFixture(t, map[string]map[string]string{
+		"nvme0n1": {
+			"size":                      "16777216\n",
+			"nsid":                      "1\n",
+			"device/model":              "Amazon Elastic Block Store              \n",
+			"device/serial":             "vol0123456789abcdef0\n",
+			"queue/rotational":          "0\n",
+			"queue/logical_block_size":  "512\n",
+			"queue/physical_block_size": "4096\n",
+		},
+		"nvme1n2": {
+			"size":                      "7323729920\n",
+			"device/model":              "Amazon EC2 NVMe Instance Storage\n",
+			"device/serial":             "AWS22A6E17D6E0A2D6A4\n",
+			"queue/rotational":          "0\n",
+			"queue/logical_block_size":  "4096\n",
+			"queue/physical_block_size": "4096\n",
+		},
+		"sda": {
+			"size":                      "1953525168\n",
+			"device/model":              "ST1000DM010-2EP1\n",
+			"device/vpd_pg80":           "\x00\x80\x00\x08Z9A1B2C3",
+			"queue/rotational":          "1\n",
+			"queue/logical_block_size":  "512\n",
+			"queue/physical_block_size": "4096\n",
+		},
+		"loop0": {"size": "1024\n"},                     // virtual, no device
+		"sr0":   {"size": "0\n", "device/model": "DVD"}, // empty drive
+	})
+
+	devices, err := ReadBlockDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BlockDevice{
+		{Name: "nvme0n1", Path: "/dev/nvme0n1", Model: "Amazon Elastic Block Store", Serial: "vol0123456789abcdef0",
+			SizeBytes: 8 << 30, LogicalBlockSize: 512, PhysicalBlockSize: 4096, NVMeNamespace: 1},
+		{Name: "nvme1n2", Path: "/dev/nvme1n2", Model: "Amazon EC2 NVMe Instance Storage", Serial: "AWS22A6E17D6E0A2D6A4",
+			SizeBytes: 7323729920 * 512, LogicalBlockSize: 4096, PhysicalBlockSize: 4096, NVMeNamespace: 2},
+		{Name: "sda", Path: "/dev/sda", Model: "ST1000DM010-2EP1", Serial: "Z9A1B2C3",
+			SizeBytes: 1953525168 * 512, Rotational: true, LogicalBlockSize: 512, PhysicalBlockSize: 4096},
+	}
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("got\n%+v\nwant\n%+v", devices, expected)
+	}
+}
+
+func TestReadBlockDevicesWithoutSysfs(t *testing.T) {
+	if _, err := ReadBlockDevices(t.TempDir()); err == nil {
+		t.Error("expected an error for a root without block/")
+	}
+}
+
+func TestSetSysfsRoot(t *testing.T) {
+	root := writeSysfsFixture(t, map[string]map[string]string{"vda": {"size": "2048\n", "device/model": "QEMU HARDDISK"}})
+	SetSysfsRoot(root)
+	defer SetSysfsRoot("")
+
+	if devices := GetBlockDevices(); len(devices) != 1 || devices[0].Name != "vda" || devices[0].SizeBytes != 2048*512 {
+		t.Errorf("GetBlockDevices() = %+v", devices)
+	}
+	SetSysfsRoot("")
+	if SysfsRoot() != DefaultSysfsRoot {
+		t.Errorf("SysfsRoot() = %v after a reset", SysfsRoot())
+	}
+}
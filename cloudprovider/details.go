@@ -0,0 +1,26 @@
+package cloudprovider
+
+import (
+	"sync"
+)
+
+type DetailsConstructor func() ProviderDetails
+
+var detailsRegistry = struct {
+	mutex   sync.RWMutex
+	entries map[CloudProviderType]DetailsConstructor
+}{entries: map[CloudProviderType]DetailsConstructor{}}
+
+// Registers the type MachineInfo.Details of the provider is decoded into.
+// The constructor returns a new pointer to be filled by the JSON or YAML decoder
+func RegisterDetails(name CloudProviderType, constructor DetailsConstructor) {
+	detailsRegistry.mutex.Lock()
+	defer detailsRegistry.mutex.Unlock()
+	detailsRegistry.entries[name] = constructor
+}
+
+func getDetailsConstructor(name CloudProviderType) DetailsConstructor {
+	detailsRegistry.mutex.RLock()
+	defer detailsRegistry.mutex.RUnlock()
+	return detailsRegistry.entries[name]
+}
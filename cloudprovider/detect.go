@@ -0,0 +1,223 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ec2metadata "github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+const (
+	DefaultDMIRoot = "/sys/class/dmi/id"
+
+	defaultProbeTimeout = time.Second
+	azureAssetTag       = "7783-7084-3265-9085-8269-3286-77"
+	ociAssetTag         = "OracleCloud.com"
+)
+
+// Reads the DMI fields used as local evidence of the platform
+type DMIInfo struct {
+	SysVendor       string
+	ProductName     string
+	ProductVersion  string
+	BiosVendor      string
+	BoardAssetTag   string
+	ChassisAssetTag string
+}
+
+func ReadDMIInfo(root string) *DMIInfo {
+	read := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(content))
+	}
+	return &DMIInfo{
+		SysVendor:       read("sys_vendor"),
+		ProductName:     read("product_name"),
+		ProductVersion:  read("product_version"),
+		BiosVendor:      read("bios_vendor"),
+		BoardAssetTag:   read("board_asset_tag"),
+		ChassisAssetTag: read("chassis_asset_tag"),
+	}
+}
+
+func (dmi *DMIInfo) IsAvailable() bool {
+	return dmi.SysVendor != "" || dmi.ProductName != ""
+}
+
+// Returns the clouds the DMI fields point at, most specific evidence first
+func (dmi *DMIInfo) Candidates() (candidates []CloudProviderType) {
+	switch {
+	case dmi.SysVendor == "Amazon EC2",
+		dmi.BiosVendor == "Amazon EC2",
+		strings.HasPrefix(dmi.BoardAssetTag, "i-"),                      // Nitro reports the instance id here
+		strings.Contains(strings.ToLower(dmi.ProductVersion), "amazon"): // Xen based instances
+		candidates = append(candidates, CloudProvider_Aws)
+	}
+	switch {
+	case dmi.ChassisAssetTag == azureAssetTag,
+		dmi.SysVendor == "Microsoft Corporation" && dmi.ProductName == "Virtual Machine":
+		candidates = append(candidates, CloudProvider_Azure)
+	}
+	switch {
+	case dmi.ProductName == "Google Compute Engine",
+		dmi.SysVendor == "Google",
+		dmi.BiosVendor == "Google":
+		candidates = append(candidates, CloudProvider_Gcp)
+	}
+	if dmi.ChassisAssetTag == ociAssetTag {
+		candidates = append(candidates, CloudProvider_Oci)
+	}
+	return
+}
+
+// The cloud named by DMI evidence no other platform reports, "" if there is none or more than one
+func (dmi *DMIInfo) Conclusive() CloudProviderType {
+	candidates := dmi.Candidates()
+	if len(candidates) != 1 {
+		return ""
+	}
+	if candidates[0] == CloudProvider_Azure && dmi.ChassisAssetTag != azureAssetTag {
+		// every Hyper-V guest reports Microsoft Corporation / Virtual Machine
+		return ""
+	}
+	return candidates[0]
+}
+
+type ProbeFunc func(ctx context.Context, name CloudProviderType) bool
+
+type Detector struct {
+	DMIRoot string
+	Probe   ProbeFunc
+}
+
+func NewDetector() *Detector {
+	return &Detector{DMIRoot: DefaultDMIRoot, Probe: ProbeMetadataServer}
+}
+
+// Returns the cloud we are running on, or OnPrem/Config if no cloud could be confirmed.
+// DMI evidence selects the candidates, the metadata server confirms them. Conclusive DMI evidence
+// is enough when the metadata server does not answer.
+// Without DMI (e.g. /sys is not mounted in the container) every cloud is probed.
+func (d *Detector) Detect() CloudProviderType {
+	name, _ := d.DetectContext(context.Background())
+	return name
+}
+
+// Same as Detect, failing with ctx.Err() if ctx ended before a candidate was confirmed
+func (d *Detector) DetectContext(ctx context.Context) (CloudProviderType, error) {
+	dmi := ReadDMIInfo(d.DMIRoot)
+	candidates := dmi.Candidates()
+	if !dmi.IsAvailable() {
+		candidates = []CloudProviderType{
+			CloudProvider_Aws,
+			CloudProvider_Azure,
+			CloudProvider_Gcp,
+			CloudProvider_Oci,
+		}
+	}
+	for _, name := range candidates {
+		if d.Probe == nil || d.Probe(ctx, name) {
+			return name, nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		// the probes failed because ctx ended, not because the clouds are absent
+		return "", err
+	}
+	if name := dmi.Conclusive(); name != "" {
+		// the metadata server may be out of reach, e.g. in a container behind the IMDSv2 hop limit
+		return name, nil
+	}
+	return CloudProvider_OnPremConfig, nil
+}
+
+var probeClient = &http.Client{Timeout: defaultProbeTimeout}
+
+// Short liveness check of the provider's metadata server, at the endpoint configured in the environment.
+// On AWS the IPv6 endpoint is tried when the IPv4 one is unreachable, unless the endpoint mode selects one
+func ProbeMetadataServer(ctx context.Context, name CloudProviderType) bool {
+	if name != CloudProvider_Aws {
+		return probeMetadataServer(ctx, name, "") == nil
+	}
+	endpoints, err := ec2metadata.IMDSEndpoints("", ec2metadata.EndpointModeAuto)
+	if err != nil {
+		return false
+	}
+	for _, endpoint := range endpoints {
+		err = probeMetadataServer(ctx, name, endpoint)
+		if err == nil {
+			return true
+		}
+		// a refused or reset connection is an answer from a host without IMDS
+		if ctx.Err() != nil || !ec2metadata.IsUnreachable(err) {
+			break
+		}
+	}
+	return false
+}
+
+func probeMetadataServer(ctx context.Context, name CloudProviderType, endpoint string) error {
+	var request *http.Request
+	var err error
+	switch name {
+	case CloudProvider_Aws:
+		request, err = http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+		if err == nil {
+			request.Header.Add("X-aws-ec2-metadata-token-ttl-seconds", "60")
+		}
+	case CloudProvider_Azure:
+		request, err = http.NewRequestWithContext(ctx, http.MethodGet, ec2metadata.AzureMetadataEndpoint()+"/metadata/instance?api-version=2021-02-01", nil)
+		if err == nil {
+			request.Header.Add("Metadata", "True")
+		}
+	case CloudProvider_Gcp:
+		request, err = http.NewRequestWithContext(ctx, http.MethodGet, ec2metadata.GCEMetadataEndpoint()+"/computeMetadata/v1/", nil)
+		if err == nil {
+			request.Header.Add("Metadata-Flavor", "Google")
+		}
+	case CloudProvider_Oci:
+		request, err = http.NewRequestWithContext(ctx, http.MethodGet, ec2metadata.OCIMetadataEndpoint()+"/opc/v2/instance/", nil)
+		if err == nil {
+			request.Header.Add("Authorization", "Bearer Oracle")
+		}
+	default:
+		return fmt.Errorf("%v: %w", name, ErrUnimplemented)
+	}
+	if err != nil {
+		return err
+	}
+
+	response, err := probeClient.Do(request)
+	if err != nil {
+		return ec2metadata.NewRequestError(request, err)
+	}
+	response.Body.Close()
+
+	if name == CloudProvider_Aws && response.StatusCode != 200 {
+		// IMDSv2 may be disabled, fall back to IMDSv1
+		request, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/latest/meta-data/instance-id", nil)
+		if err != nil {
+			return err
+		}
+		response, err = probeClient.Do(request)
+		if err != nil {
+			return ec2metadata.NewRequestError(request, err)
+		}
+		response.Body.Close()
+	}
+	if response.StatusCode != 200 {
+		return ec2metadata.NewStatusError(request, response)
+	}
+	if name == CloudProvider_Gcp && response.Header.Get("Metadata-Flavor") != "Google" {
+		return fmt.Errorf("%v: missing Metadata-Flavor response header: %w", request.URL, ErrNotDetected)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package cloudprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ec2metadata "github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+func writeDMIFixture(t *testing.T, fields map[string]string) string {
+	root := t.TempDir()
+	for name, value := range fields {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    map[string]string
+		reachable map[CloudProviderType]bool
+		expected  CloudProviderType
+	}{
+		{
+			name:      "aws nitro",
+			fields:    map[string]string{"sys_vendor": "Amazon EC2", "product_name": "m6id.2xlarge", "board_asset_tag": "i-0123456789abcdef0"},
+			reachable: map[CloudProviderType]bool{CloudProvider_Aws: true},
+			expected:  CloudProvider_Aws,
+		},
+		{
+			name:      "aws xen",
+			fields:    map[string]string{"sys_vendor": "Xen", "product_name": "HVM domU", "product_version": "4.11.amazon"},
+			reachable: map[CloudProviderType]bool{CloudProvider_Aws: true},
+			expected:  CloudProvider_Aws,
+		},
+		{
+			name:      "aws container behind the hop limit",
+			fields:    map[string]string{"sys_vendor": "Amazon EC2", "product_name": "m6id.2xlarge"},
+			reachable: map[CloudProviderType]bool{},
+			expected:  CloudProvider_Aws,
+		},
+		{
+			name:      "azure",
+			fields:    map[string]string{"sys_vendor": "Microsoft Corporation", "product_name": "Virtual Machine", "chassis_asset_tag": azureAssetTag},
+			reachable: map[CloudProviderType]bool{CloudProvider_Azure: true},
+			expected:  CloudProvider_Azure,
+		},
+		{
+			name:      "gcp",
+			fields:    map[string]string{"sys_vendor": "Google", "product_name": "Google Compute Engine"},
+			reachable: map[CloudProviderType]bool{CloudProvider_Gcp: true},
+			expected:  CloudProvider_Gcp,
+		},
+		{
+			name:      "oci",
+			fields:    map[string]string{"sys_vendor": "QEMU", "chassis_asset_tag": ociAssetTag},
+			reachable: map[CloudProviderType]bool{CloudProvider_Oci: true},
+			expected:  CloudProvider_Oci,
+		},
+		{
+			name:      "hyper-v without metadata server",
+			fields:    map[string]string{"sys_vendor": "Microsoft Corporation", "product_name": "Virtual Machine"},
+			reachable: map[CloudProviderType]bool{},
+			expected:  CloudProvider_OnPremConfig,
+		},
+		{
+			name:      "bare metal",
+			fields:    map[string]string{"sys_vendor": "Dell Inc.", "product_name": "PowerEdge R750"},
+			reachable: map[CloudProviderType]bool{CloudProvider_Aws: true},
+			expected:  CloudProvider_OnPremConfig,
+		},
+		{
+			name:      "no dmi",
+			fields:    map[string]string{},
+			reachable: map[CloudProviderType]bool{CloudProvider_Gcp: true},
+			expected:  CloudProvider_Gcp,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := writeDMIFixture(t, test.fields)
+			if len(test.fields) == 0 {
+				root = filepath.Join(root, "missing")
+			}
+			probed := []CloudProviderType{}
+			detector := &Detector{
+				DMIRoot: root,
+				Probe: func(ctx context.Context, name CloudProviderType) bool {
+					probed = append(probed, name)
+					return test.reachable[name]
+				},
+			}
+			if got := detector.Detect(); got != test.expected {
+				t.Errorf("Detect() = %v, want %v (probed %v)", got, test.expected, probed)
+			}
+		})
+	}
+}
+
+func TestProbeMetadataServerEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("token"))
+		case r.URL.Path == "/metadata/instance" && r.Header.Get("Metadata") == "True":
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv(ec2metadata.IMDSEndpointEnv, server.URL)
+	t.Setenv(ec2metadata.AzureMetadataEndpointEnv, server.URL)
+	t.Setenv(ec2metadata.OCIMetadataEndpointEnv, server.URL)
+	for name, want := range map[CloudProviderType]bool{CloudProvider_Aws: true, CloudProvider_Azure: true, CloudProvider_Oci: false} {
+		if got := ProbeMetadataServer(context.Background(), name); got != want {
+			t.Errorf("ProbeMetadataServer(%v) = %v", name, got)
+		}
+	}
+
+	t.Setenv(ec2metadata.IMDSEndpointEnv, "")
+	t.Setenv(ec2metadata.IMDSEndpointModeEnv, "IPv5")
+	if ProbeMetadataServer(context.Background(), CloudProvider_Aws) {
+		t.Error("invalid endpoint mode probed")
+	}
+}
+
+func TestDetectCancelled(t *testing.T) {
+	root := writeDMIFixture(t, map[string]string{"sys_vendor": "Dell Inc.", "product_name": "PowerEdge R750"})
+	detector := &Detector{DMIRoot: root, Probe: func(ctx context.Context, name CloudProviderType) bool {
+		return false
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if name, err := detector.DetectContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("DetectContext() = %v, %v, want the context error", name, err)
+	}
+	if _, err := GetCurrentCloudProviderContext(ctx, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetCurrentCloudProviderContext() = %v", err)
+	}
+}
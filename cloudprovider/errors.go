@@ -0,0 +1,28 @@
+package cloudprovider
+
+import (
+	ec2metadata "github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+// Provider errors wrap one of these, test with errors.Is
+var (
+	// Not running on this cloud / environment, or the provider was not initialized
+	ErrNotDetected = ec2metadata.ErrNotDetected
+	// The metadata server did not answer in time
+	ErrTimeout = ec2metadata.ErrTimeout
+	// The metadata server refused the request, e.g. IMDSv2 is required
+	ErrUnauthorized = ec2metadata.ErrUnauthorized
+	// Configuration (file, environment or option) is missing required values or cannot be parsed
+	ErrInvalidConfig = ec2metadata.ErrInvalidConfig
+	// The requested functionality is not implemented by the provider
+	ErrUnimplemented = ec2metadata.ErrUnimplemented
+	// A signed metadata document (identity document, attestation) does not match its signature
+	ErrInvalidSignature = ec2metadata.ErrInvalidSignature
+	// A signed metadata document is signed by a certificate that is not trusted
+	ErrUntrustedCertificate = ec2metadata.ErrUntrustedCertificate
+	// A verified attestation was issued for another nonce or machine, or outside its validity period
+	ErrAttestationMismatch = ec2metadata.ErrAttestationMismatch
+)
+
+// Details of a failed metadata request, use errors.As
+type MetadataError = ec2metadata.MetadataError
@@ -0,0 +1,68 @@
+package cloudprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type LifecycleEventType string
+
+const (
+	LifecycleEvent_Preemption  LifecycleEventType = "preemption" // spot/preemptible capacity is reclaimed
+	LifecycleEvent_Rebalance   LifecycleEventType = "rebalance"  // elevated risk of preemption
+	LifecycleEvent_Reboot      LifecycleEventType = "reboot"
+	LifecycleEvent_Redeploy    LifecycleEventType = "redeploy" // moved to another host, local disks are lost
+	LifecycleEvent_Freeze      LifecycleEventType = "freeze"   // paused for a few seconds, e.g. live migration
+	LifecycleEvent_Maintenance LifecycleEventType = "maintenance"
+	LifecycleEvent_Retirement  LifecycleEventType = "retirement" // the instance is stopped or terminated for good
+	LifecycleEvent_Termination LifecycleEventType = "termination"
+)
+
+// A provider neutral notice about something that is going to happen to the machine
+type LifecycleEvent struct {
+	Provider    CloudProviderType
+	Type        LifecycleEventType
+	ID          string    // provider event id, used to acknowledge the event
+	NotBefore   time.Time // zero if unknown or already started
+	Started     bool      // the event is in progress
+	Description string
+	Source      interface{} // the provider specific event, e.g. *amz.InterruptionEvent
+}
+
+func (event *LifecycleEvent) String() string {
+	return fmt.Sprintf(`{%v %v  ID: %v  NotBefore: %v  Started: %v  %v}`, event.Provider, event.Type, event.ID,
+		event.NotBefore.Format(time.RFC3339), event.Started, event.Description)
+}
+
+type LifecycleEventHandler func(event *LifecycleEvent)
+
+// Implemented by providers that can notify about preemption and maintenance
+type ILifecycleEventSource interface {
+	ICloudProviderVirtualMachine
+	// Calls handler for each new event until ctx is done, returns ctx.Err()
+	WatchLifecycleEvents(ctx context.Context, handler LifecycleEventHandler) error
+}
+
+// Implemented by providers that let the machine expedite an event, e.g. once it is drained
+type ILifecycleEventAcknowledger interface {
+	AcknowledgeLifecycleEvent(ctx context.Context, event *LifecycleEvent) error
+}
+
+// Uses the provider's WatchLifecycleEvents, ErrUnimplemented if it has none
+func WatchLifecycleEvents(ctx context.Context, provider ICloudProviderVirtualMachine, handler LifecycleEventHandler) error {
+	source, ok := provider.(ILifecycleEventSource)
+	if !ok {
+		return fmt.Errorf("%v lifecycle events: %w", provider.GetName(), ErrUnimplemented)
+	}
+	return source.WatchLifecycleEvents(ctx, handler)
+}
+
+// Uses the provider's AcknowledgeLifecycleEvent, ErrUnimplemented if it has none
+func AcknowledgeLifecycleEvent(ctx context.Context, provider ICloudProviderVirtualMachine, event *LifecycleEvent) error {
+	acknowledger, ok := provider.(ILifecycleEventAcknowledger)
+	if !ok {
+		return fmt.Errorf("%v acknowledge lifecycle event: %w", provider.GetName(), ErrUnimplemented)
+	}
+	return acknowledger.AcknowledgeLifecycleEvent(ctx, event)
+}
@@ -0,0 +1,105 @@
+package cloudprovider
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Bumped on incompatible changes of the MachineInfo encoding.
+// Decoding rejects payloads of a newer version.
+const MachineInfoSchemaVersion = 1
+
+// MachineInfo with its details, which are only known as an interface to MachineInfo
+type machineInfoDocument struct {
+	MachineInfo `yaml:",inline"`
+	Details     interface{} `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+type machineInfoJSONDocument struct {
+	MachineInfo
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func (info *MachineInfo) ToJSON() ([]byte, error) {
+	return json.Marshal(info.document())
+}
+
+func (info *MachineInfo) ToYAML() ([]byte, error) {
+	return yaml.Marshal(info.document())
+}
+
+// Details are decoded only if a type is registered for the provider, see RegisterDetails
+func MachineInfoFromJSON(data []byte) (*MachineInfo, error) {
+	doc := &machineInfoJSONDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%w: machine info: %v", ErrInvalidConfig, err)
+	}
+	info := &doc.MachineInfo
+	if err := info.checkVersion(); err != nil {
+		return nil, err
+	}
+	if len(doc.Details) > 0 && string(doc.Details) != "null" {
+		if err := info.decodeDetails(func(details ProviderDetails) error {
+			return json.Unmarshal(doc.Details, details)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func MachineInfoFromYAML(data []byte) (*MachineInfo, error) {
+	doc := &machineInfoDocument{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%w: machine info: %v", ErrInvalidConfig, err)
+	}
+	info := &doc.MachineInfo
+	if err := info.checkVersion(); err != nil {
+		return nil, err
+	}
+	if doc.Details != nil {
+		// decoded as a generic map, encode it again to decode it into the registered type
+		raw, err := yaml.Marshal(doc.Details)
+		if err != nil {
+			return nil, fmt.Errorf("%w: machine info details: %v", ErrInvalidConfig, err)
+		}
+		if err := info.decodeDetails(func(details ProviderDetails) error {
+			return yaml.Unmarshal(raw, details)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func (info *MachineInfo) document() *machineInfoDocument {
+	doc := &machineInfoDocument{MachineInfo: *info}
+	doc.SchemaVersion = MachineInfoSchemaVersion
+	if info.Details != nil {
+		doc.Details = info.Details
+	}
+	return doc
+}
+
+func (info *MachineInfo) checkVersion() error {
+	if info.SchemaVersion < 1 || info.SchemaVersion > MachineInfoSchemaVersion {
+		return fmt.Errorf("%w: unsupported machine info schema version %v", ErrInvalidConfig, info.SchemaVersion)
+	}
+	return nil
+}
+
+func (info *MachineInfo) decodeDetails(decode func(details ProviderDetails) error) error {
+	constructor := getDetailsConstructor(info.Provider)
+	if constructor == nil {
+		// unknown to this binary, Additional still carries the text rendering
+		return nil
+	}
+	details := constructor()
+	if err := decode(details); err != nil {
+		return fmt.Errorf("%w: %v machine info details: %v", ErrInvalidConfig, info.Provider, err)
+	}
+	info.Details = details
+	return nil
+}
@@ -0,0 +1,159 @@
+package cloudprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateSchema = flag.Bool("update", false, "rewrite machine_info.schema.json")
+
+const machineInfoSchemaFile = "machine_info.schema.json"
+
+func testMachineInfo() *MachineInfo {
+	return &MachineInfo{
+		InstanceID:   "i-0123456789abcdef0",
+		Zone:         "us-east-1a",
+		Region:       "us-east-1",
+		Architecture: "x86_64",
+		IPAddresses:  []string{"10.0.0.7", "10.0.1.7"},
+		PublicDNS:    "ec2-3-1-2-3.compute-1.amazonaws.com",
+		Cluster:      "vlz-eks",
+		Additional:   []AdditionalParam{{Key: "InstanceType", Value: "i4i.4xlarge"}},
+	}
+}
+
+func TestMachineInfoRoundTrip(t *testing.T) {
+	info := testMachineInfo()
+	expected := *info
+	expected.SchemaVersion = MachineInfoSchemaVersion
+
+	data, err := info.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := MachineInfoFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*decoded, expected) {
+		t.Errorf("JSON round trip:\n got %+v\nwant %+v", decoded, expected)
+	}
+
+	data, err = info.ToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = MachineInfoFromYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*decoded, expected) {
+		t.Errorf("YAML round trip:\n got %+v\nwant %+v", decoded, expected)
+	}
+
+	if info.SchemaVersion != 0 {
+		t.Error("encoding modified the encoded MachineInfo")
+	}
+}
+
+func TestMachineInfoFieldNames(t *testing.T) {
+	data, _ := testMachineInfo().ToJSON()
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"schema_version", "instance_id", "zone", "region", "architecture", "ip_addresses", "public_dns", "cluster", "additional"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("field %v is missing from %s", name, data)
+		}
+	}
+}
+
+func TestMachineInfoRejectsUnknownVersion(t *testing.T) {
+	for _, data := range []string{`{"instance_id": "vm1"}`, `{"schema_version": 99, "instance_id": "vm1"}`, `{`} {
+		if _, err := MachineInfoFromJSON([]byte(data)); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v: got %v, want ErrInvalidConfig", data, err)
+		}
+	}
+}
+
+// The schema file is shipped for consumers, it must match the type
+func TestMachineInfoJSONSchema(t *testing.T) {
+	schema, err := MachineInfoJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema = append(schema, '\n')
+	if *updateSchema {
+		if err := os.WriteFile(machineInfoSchemaFile, schema, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current, err := os.ReadFile(machineInfoSchemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, schema) {
+		t.Errorf("%v is out of date, run: go test ./cloudprovider -run TestMachineInfoJSONSchema -update", machineInfoSchemaFile)
+	}
+}
+
+type testDetails struct {
+	Disks []string `json:"disks" yaml:"disks"`
+}
+
+func (details *testDetails) ToArr() []AdditionalParam {
+	return []AdditionalParam{{Key: "Disks", Value: fmt.Sprintf("%v", details.Disks)}}
+}
+
+func TestMachineInfoDetails(t *testing.T) {
+	const provider CloudProviderType = "Test/Details"
+	RegisterDetails(provider, func() ProviderDetails { return &testDetails{} })
+	defer func() {
+		detailsRegistry.mutex.Lock()
+		delete(detailsRegistry.entries, provider)
+		detailsRegistry.mutex.Unlock()
+	}()
+
+	info := testMachineInfo()
+	info.Provider = provider
+	info.Details = &testDetails{Disks: []string{"nvme0n1", "nvme1n1"}}
+
+	encoders := map[string]func() ([]byte, error){"JSON": info.ToJSON, "YAML": info.ToYAML}
+	decoders := map[string]func([]byte) (*MachineInfo, error){"JSON": MachineInfoFromJSON, "YAML": MachineInfoFromYAML}
+	for format, encode := range encoders {
+		data, err := encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decoders[format](data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded.Details, info.Details) {
+			t.Errorf("%v: Details = %+v, want %+v", format, decoded.Details, info.Details)
+		}
+	}
+
+	// details of providers unknown to the decoder are dropped, the text rendering remains
+	info.Provider = "Test/Unknown"
+	data, _ := info.ToJSON()
+	decoded, err := MachineInfoFromJSON(data)
+	if err != nil || decoded.Details != nil || len(decoded.Additional) == 0 {
+		t.Errorf("unknown provider: got %+v, %v", decoded, err)
+	}
+}
+
+func TestMachineInfoTextFromDetails(t *testing.T) {
+	info := &MachineInfo{InstanceID: "vm1", Details: &testDetails{Disks: []string{"sda"}}}
+	if text := info.ToText(); !strings.Contains(text, "Disks") || !strings.Contains(text, "[sda]") {
+		t.Errorf("ToText() = %v", text)
+	}
+}
@@ -1,28 +1,42 @@
 package cloudprovider
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
 type AdditionalParam struct {
-	Key   string
-	Value string
+	Key   string `json:"key" yaml:"key" desc:"Provider specific parameter name"`
+	Value string `json:"value" yaml:"value" desc:"Parameter value as text"`
 }
 
 func (param *AdditionalParam) ToText() string {
 	return fmt.Sprintf(`%-27v%v`, param.Key, param.Value)
 }
 
+// Typed provider specific information, e.g. *amz.AdditionalInfo.
+// Providers expose a typed accessor (amz.GetDetails, azure.GetDetails, ...) and register a decoder with RegisterDetails
+type ProviderDetails interface {
+	// Human readable rendering, also stored in MachineInfo.Additional
+	ToArr() []AdditionalParam
+}
+
+// Serialized with the field names below, see MachineInfoSchemaVersion and MachineInfoJSONSchema.
+// Details is encoded under "details", decoded by the type registered for Provider
 type MachineInfo struct {
-	InstanceID   string
-	Zone         string
-	Region       string
-	Architecture string
-	IPAddresses  []string
-	PublicDNS    string
-	Cluster      string
-	Additional   []AdditionalParam
+	SchemaVersion int               `json:"schema_version" yaml:"schema_version" desc:"Version of this format, set on encoding"`
+	Provider      CloudProviderType `json:"provider,omitempty" yaml:"provider,omitempty" desc:"Cloud provider type that produced the information"`
+	InstanceID    string            `json:"instance_id" yaml:"instance_id" desc:"Unique id of the machine within its provider"`
+	Zone          string            `json:"zone" yaml:"zone" desc:"Availability zone, or the configured zone on premises"`
+	Region        string            `json:"region" yaml:"region" desc:"Region the zone belongs to"`
+	Architecture  string            `json:"architecture" yaml:"architecture" desc:"CPU architecture, if known"`
+	IPAddresses   []string          `json:"ip_addresses" yaml:"ip_addresses" desc:"Private IP addresses"`
+	PublicDNS     string            `json:"public_dns" yaml:"public_dns" desc:"Public DNS name or IP address, if any"`
+	Cluster       string            `json:"cluster,omitempty" yaml:"cluster,omitempty" desc:"Kubernetes cluster the machine belongs to, if any"`
+	Disks         []BlockDevice     `json:"disks,omitempty" yaml:"disks,omitempty" desc:"Local block devices, see ReadBlockDevices"`
+	Additional    []AdditionalParam `json:"additional,omitempty" yaml:"additional,omitempty" desc:"Provider specific parameters"`
+	Details       ProviderDetails   `json:"-" yaml:"-"`
 }
 
 func (info *MachineInfo) ToText() string {
@@ -37,9 +51,19 @@ func (info *MachineInfo) ToText() string {
 	if info.Cluster != "" {
 		arr = append(arr, fmt.Sprintf(`Cluster:                   %v`, info.Cluster))
 	}
-	if info.Additional != nil {
+	if len(info.Disks) > 0 {
+		arr = append(arr, "==== Disks ====")
+		for _, d := range info.Disks {
+			arr = append(arr, d.String())
+		}
+	}
+	additional := info.Additional
+	if additional == nil && info.Details != nil {
+		additional = info.Details.ToArr()
+	}
+	if additional != nil {
 		arr = append(arr, "==== Additional ====")
-		for _, p := range info.Additional {
+		for _, p := range additional {
 			arr = append(arr, p.ToText())
 		}
 	}
@@ -53,42 +77,66 @@ type ICloudProviderVirtualMachine interface {
 	GetMachineInfo() (info *MachineInfo, err error)
 }
 
+// Context aware variant, the context bounds and cancels all metadata lookups.
+// Init and GetMachineInfo are expected to be wrappers using context.Background()
+type ICloudProviderVirtualMachineContext interface {
+	ICloudProviderVirtualMachine
+	InitContext(ctx context.Context) error
+	GetMachineInfoContext(ctx context.Context) (info *MachineInfo, err error)
+}
+
 type ServiceProviderConstructor func() ICloudProviderVirtualMachine
 
 func GetVirtualMachineID(provider ICloudProviderVirtualMachine) (instanceId string, err error) {
-	info, err := provider.GetMachineInfo()
+	return GetVirtualMachineIDContext(context.Background(), provider)
+}
+
+func GetVirtualMachineIDContext(ctx context.Context, provider ICloudProviderVirtualMachine) (instanceId string, err error) {
+	info, err := GetMachineInfoContext(ctx, provider)
 	if err == nil {
 		instanceId = info.InstanceID
 	}
 	return
 }
 
+// Uses the provider's InitContext if implemented, otherwise Init
+func InitContext(ctx context.Context, provider ICloudProviderVirtualMachine) error {
+	if p, ok := provider.(ICloudProviderVirtualMachineContext); ok {
+		return p.InitContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return provider.Init()
+}
+
+// Uses the provider's GetMachineInfoContext if implemented, otherwise GetMachineInfo
+func GetMachineInfoContext(ctx context.Context, provider ICloudProviderVirtualMachine) (*MachineInfo, error) {
+	if p, ok := provider.(ICloudProviderVirtualMachineContext); ok {
+		return p.GetMachineInfoContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return provider.GetMachineInfo()
+}
+
 type CloudProviderType string
 
 const (
 	CloudProvider_Aws          CloudProviderType = "AWS"
 	CloudProvider_Azure        CloudProviderType = "Azure"
+	CloudProvider_Gcp          CloudProviderType = "GCP"
+	CloudProvider_Oci          CloudProviderType = "OCI"
 	CloudProvider_OnPremConfig CloudProviderType = "OnPrem/Config"
 	CloudProvider_OnPremEnv    CloudProviderType = "OnPrem/ENV"
 )
 
-var supportedCloudProviders = []CloudProviderType{
-	CloudProvider_Aws,
-	CloudProvider_Azure,
-	CloudProvider_OnPremConfig,
-	CloudProvider_OnPremEnv,
-}
-
 func ConvertToCloudProviderType(s string) (t CloudProviderType, err error) {
 
-	stringToCloudProviderType := map[string]CloudProviderType{}
-	for _, p := range supportedCloudProviders {
-		stringToCloudProviderType[string(p)] = p
-	}
-
-	t, ok := stringToCloudProviderType[s]
-	if !ok {
-		err = fmt.Errorf("Unsupported cloud provider type %v", s)
+	t = CloudProviderType(s)
+	if !IsRegistered(t) {
+		err = fmt.Errorf("Unsupported cloud provider type %v: %w", s, ErrInvalidConfig)
 	}
 	return
 }
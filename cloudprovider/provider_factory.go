@@ -1,7 +1,8 @@
 package cloudprovider
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"os"
 
 	ec2metadata "github.com/VolumezTech/volumez-cloud-provider/util"
@@ -11,9 +12,7 @@ type CloudProvider struct {
 	Name CloudProviderType
 }
 
-var errUnimplemented = errors.New("provider is not implemented")
-
-var _ ICloudProviderVirtualMachine = (*CloudProvider)(nil)
+var _ ICloudProviderVirtualMachineContext = (*CloudProvider)(nil)
 
 func GetCloudProvider(name string) (p *CloudProvider, err error) {
 	t, err := ConvertToCloudProviderType(name)
@@ -25,10 +24,17 @@ func GetCloudProvider(name string) (p *CloudProvider, err error) {
 
 func GetCurrentCloudProvider(useHostNameAsVMID bool) (*CloudProvider, error) {
 
-	//  Detect what provider we are on - implement later
-	name := CloudProvider_Aws
-	if useHostNameAsVMID {
-		name = CloudProvider_OnPremConfig
+	return GetCurrentCloudProviderContext(context.Background(), useHostNameAsVMID)
+}
+
+func GetCurrentCloudProviderContext(ctx context.Context, useHostNameAsVMID bool) (*CloudProvider, error) {
+
+	name := CloudProvider_OnPremConfig
+	if !useHostNameAsVMID {
+		var err error
+		if name, err = NewDetector().DetectContext(ctx); err != nil {
+			return nil, err
+		}
 	}
 
 	return GetCloudProvider(string(name))
@@ -39,6 +45,10 @@ func (cp *CloudProvider) GetName() CloudProviderType {
 }
 
 func (cp *CloudProvider) Init() (err error) {
+	return cp.InitContext(context.Background())
+}
+
+func (cp *CloudProvider) InitContext(ctx context.Context) (err error) {
 	return
 }
 
@@ -50,28 +60,42 @@ func (cp *CloudProvider) GetVirtualMachineID() (id string, err error) {
 	return
 }
 
-var cloudProviderGetters = map[CloudProviderType]func() (info *MachineInfo, err error){
+// Lightweight lookups that don't need the full provider implementation
+var cloudProviderGetters = map[CloudProviderType]func(ctx context.Context) (info *MachineInfo, err error){
 	CloudProvider_Aws:          getAWSVM,
-	CloudProvider_Azure:        getAzureVM,
 	CloudProvider_OnPremConfig: getLocalVM,
 	CloudProvider_OnPremEnv:    getLocalVM,
 }
 
 func (cp *CloudProvider) GetMachineInfo() (info *MachineInfo, err error) {
+	return cp.GetMachineInfoContext(context.Background())
+}
+
+func (cp *CloudProvider) GetMachineInfoContext(ctx context.Context) (info *MachineInfo, err error) {
 
 	cb, ok := cloudProviderGetters[cp.Name]
 	if ok {
-		info, err = cb()
+		info, err = cb(ctx)
+	} else if constructor := getRegisteredConstructor(cp.Name); constructor != nil {
+		info, err = getRegisteredVM(ctx, constructor)
 	} else {
-		err = errUnimplemented
+		err = fmt.Errorf("%v: %w", cp.Name, ErrUnimplemented)
 	}
 	return
 }
 
-func getAWSVM() (info *MachineInfo, err error) {
-	ec2MetaData := ec2metadata.New(21600)
+func getRegisteredVM(ctx context.Context, constructor ServiceProviderConstructor) (info *MachineInfo, err error) {
+	provider := constructor()
+	if err = InitContext(ctx, provider); err != nil {
+		return nil, err
+	}
+	return GetMachineInfoContext(ctx, provider)
+}
+
+func getAWSVM(ctx context.Context) (info *MachineInfo, err error) {
+	imds := ec2metadata.NewIMDSClient(ec2metadata.IMDSClientOptions{})
 	var ec2ID string
-	ec2ID, err = ec2MetaData.GetEC2InstanceIDWithRetry(3)
+	ec2ID, err = imds.GetMetadata(ctx, "instance-id")
 	if err != nil {
 		return nil, err
 	}
@@ -79,12 +103,7 @@ func getAWSVM() (info *MachineInfo, err error) {
 	return
 }
 
-func getAzureVM() (info *MachineInfo, err error) {
-	err = errUnimplemented
-	return
-}
-
-func getLocalVM() (info *MachineInfo, err error) {
+func getLocalVM(ctx context.Context) (info *MachineInfo, err error) {
 
 	hn, err := os.Hostname()
 
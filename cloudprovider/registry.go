@@ -0,0 +1,151 @@
+package cloudprovider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Providers are probed in ascending priority order
+const (
+	PriorityOnPremEnv    = 100
+	PriorityOnPremConfig = 200
+	PriorityAws          = 300
+	PriorityAzure        = 400
+	PriorityGcp          = 500
+	PriorityOci          = 600
+)
+
+type ProviderRegistration struct {
+	Name        CloudProviderType
+	Constructor ServiceProviderConstructor // nil until a package supplies the implementation
+	Priority    int
+	Disabled    bool
+
+	seq int // registration order, breaks priority ties
+}
+
+// The built-in types are known even when their implementations (run_time_env/...) are not linked in,
+// service_provider_factory supplies their constructors with RegisterDefaultConstructor
+var builtinProviders = []ProviderRegistration{
+	{Name: CloudProvider_OnPremEnv, Priority: PriorityOnPremEnv},
+	{Name: CloudProvider_OnPremConfig, Priority: PriorityOnPremConfig},
+	{Name: CloudProvider_Aws, Priority: PriorityAws},
+	{Name: CloudProvider_Azure, Priority: PriorityAzure},
+	{Name: CloudProvider_Gcp, Priority: PriorityGcp},
+	{Name: CloudProvider_Oci, Priority: PriorityOci},
+}
+
+type providerRegistry struct {
+	mutex   sync.RWMutex
+	entries map[CloudProviderType]*ProviderRegistration
+	seq     int
+}
+
+var registry = &providerRegistry{entries: map[CloudProviderType]*ProviderRegistration{}}
+
+func init() {
+	for _, p := range builtinProviders {
+		Register(p.Name, p.Constructor, p.Priority)
+	}
+}
+
+// Adds a provider or replaces the registration of an existing one
+func Register(name CloudProviderType, constructor ServiceProviderConstructor, priority int) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	seq := registry.seq
+	if existing, ok := registry.entries[name]; ok {
+		seq = existing.seq // keep the original position among equal priorities
+	} else {
+		registry.seq++
+	}
+	registry.entries[name] = &ProviderRegistration{Name: name, Constructor: constructor, Priority: priority, seq: seq}
+}
+
+// Supplies the implementation of a registered provider that has none yet, keeping its priority
+// and whether it is disabled. Used for the built-ins, so a constructor, priority or Disable set
+// by another package before or after is not overwritten
+func RegisterDefaultConstructor(name CloudProviderType, constructor ServiceProviderConstructor) {
+	registry.update(name, func(p *ProviderRegistration) {
+		if p.Constructor == nil {
+			p.Constructor = constructor
+		}
+	})
+}
+
+func Unregister(name CloudProviderType) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.entries, name)
+}
+
+func SetPriority(name CloudProviderType, priority int) error {
+	return registry.update(name, func(p *ProviderRegistration) { p.Priority = priority })
+}
+
+// Disabled providers are still valid names but are never probed
+func Disable(name CloudProviderType) error {
+	return registry.update(name, func(p *ProviderRegistration) { p.Disabled = true })
+}
+
+func Enable(name CloudProviderType) error {
+	return registry.update(name, func(p *ProviderRegistration) { p.Disabled = false })
+}
+
+func IsRegistered(name CloudProviderType) bool {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	_, ok := registry.entries[name]
+	return ok
+}
+
+// Returns a copy of all registrations in probing order, including disabled ones
+func RegisteredProviders() []ProviderRegistration {
+	registry.mutex.RLock()
+	list := make([]ProviderRegistration, 0, len(registry.entries))
+	for _, p := range registry.entries {
+		list = append(list, *p)
+	}
+	registry.mutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority < list[j].Priority
+		}
+		return list[i].seq < list[j].seq
+	})
+	return list
+}
+
+// Returns the constructors of the enabled providers in probing order
+func GetRegisteredConstructors() []ServiceProviderConstructor {
+	constructors := []ServiceProviderConstructor{}
+	for _, p := range RegisteredProviders() {
+		if !p.Disabled && p.Constructor != nil {
+			constructors = append(constructors, p.Constructor)
+		}
+	}
+	return constructors
+}
+
+func getRegisteredConstructor(name CloudProviderType) ServiceProviderConstructor {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	if p, ok := registry.entries[name]; ok {
+		return p.Constructor
+	}
+	return nil
+}
+
+func (r *providerRegistry) update(name CloudProviderType, cb func(p *ProviderRegistration)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	p, ok := r.entries[name]
+	if !ok {
+		return fmt.Errorf("Unsupported cloud provider type %v: %w", name, ErrInvalidConfig)
+	}
+	cb(p)
+	return nil
+}
@@ -0,0 +1,92 @@
+package cloudprovider
+
+import (
+	"testing"
+)
+
+const testLabProvider CloudProviderType = "Lab"
+
+func registeredNames(enabledOnly bool) (names []CloudProviderType) {
+	for _, p := range RegisteredProviders() {
+		if !enabledOnly || !p.Disabled {
+			names = append(names, p.Name)
+		}
+	}
+	return
+}
+
+func TestRegistry(t *testing.T) {
+	if names := registeredNames(false); len(names) != len(builtinProviders) || names[0] != CloudProvider_OnPremEnv || names[2] != CloudProvider_Aws {
+		t.Fatalf("unexpected built-in order %v", names)
+	}
+	if _, err := ConvertToCloudProviderType(string(testLabProvider)); err == nil {
+		t.Fatal("unregistered provider type was accepted")
+	}
+
+	lab := func() ICloudProviderVirtualMachine { return &CloudProvider{Name: testLabProvider} }
+	Register(testLabProvider, lab, PriorityAws-1)
+	defer Unregister(testLabProvider)
+
+	if tp, err := ConvertToCloudProviderType(string(testLabProvider)); err != nil || tp != testLabProvider {
+		t.Fatalf("ConvertToCloudProviderType = %v, %v", tp, err)
+	}
+	if names := registeredNames(false); names[2] != testLabProvider || names[3] != CloudProvider_Aws {
+		t.Errorf("Lab is not probed right before AWS: %v", names)
+	}
+	if len(GetRegisteredConstructors()) != 1 {
+		t.Errorf("only Lab has a constructor in this package, got %v constructors", len(GetRegisteredConstructors()))
+	}
+
+	if err := SetPriority(testLabProvider, 0); err != nil {
+		t.Fatal(err)
+	}
+	if names := registeredNames(false); names[0] != testLabProvider {
+		t.Errorf("Lab was not moved first: %v", names)
+	}
+
+	if err := Disable(CloudProvider_Aws); err != nil {
+		t.Fatal(err)
+	}
+	defer Enable(CloudProvider_Aws)
+	for _, name := range registeredNames(true) {
+		if name == CloudProvider_Aws {
+			t.Errorf("disabled AWS is still enabled")
+		}
+	}
+	if _, err := ConvertToCloudProviderType(string(CloudProvider_Aws)); err != nil {
+		t.Errorf("disabled providers must remain valid types: %v", err)
+	}
+
+	if err := Disable("NoSuchCloud"); err == nil {
+		t.Error("Disable accepted an unregistered provider")
+	}
+}
+
+func TestRegisterDefaultConstructor(t *testing.T) {
+	lab := func() ICloudProviderVirtualMachine { return &CloudProvider{Name: testLabProvider} }
+	custom := func() ICloudProviderVirtualMachine { return &CloudProvider{Name: CloudProvider_OnPremEnv} }
+
+	// configured before the implementation is supplied
+	Register(testLabProvider, nil, PriorityGcp)
+	defer Unregister(testLabProvider)
+	Disable(testLabProvider)
+	SetPriority(testLabProvider, 0)
+	RegisterDefaultConstructor(testLabProvider, lab)
+	p := RegisteredProviders()[0]
+	if p.Name != testLabProvider || p.Priority != 0 || !p.Disabled || p.Constructor == nil {
+		t.Errorf("registration = %+v", p)
+	}
+
+	// a constructor registered under the name wins over the default
+	Register(testLabProvider, custom, 0)
+	RegisterDefaultConstructor(testLabProvider, lab)
+	if provider := getRegisteredConstructor(testLabProvider)(); provider.GetName() != CloudProvider_OnPremEnv {
+		t.Errorf("the default replaced the registered constructor")
+	}
+
+	Unregister(testLabProvider)
+	RegisterDefaultConstructor(testLabProvider, lab)
+	if IsRegistered(testLabProvider) {
+		t.Errorf("the default constructor registered a removed provider")
+	}
+}
@@ -1,7 +1,7 @@
 package amz
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
@@ -9,37 +9,55 @@ import (
 	"strings"
 
 	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
 )
 
+// AWS details of MachineInfo, see GetDetails
 type AdditionalInfo struct {
-	InstanceType            string
-	GroupName               string
-	ImageID                 string
-	Macs                    []*MacInfo
-	AccountID               string
-	BillingProducts         []string
-	MarketplaceProductCodes []string
+	InstanceType            string              `json:"instance_type" yaml:"instance_type"`
+	GroupName               string              `json:"group_name" yaml:"group_name"`
+	ImageID                 string              `json:"image_id" yaml:"image_id"`
+	Macs                    []*MacInfo          `json:"macs" yaml:"macs"`
+	AccountID               string              `json:"account_id" yaml:"account_id"`
+	BillingProducts         []string            `json:"billing_products" yaml:"billing_products"`
+	MarketplaceProductCodes []string            `json:"marketplace_product_codes" yaml:"marketplace_product_codes"`
+	Volumes                 []*Volume           `json:"volumes" yaml:"volumes"`
+	ScheduledEvents         []*MaintenanceEvent `json:"scheduled_events" yaml:"scheduled_events"` // empty if the lookup failed, see GetScheduledMaintenanceEvents
+	EventsHistory           []*MaintenanceEvent `json:"events_history" yaml:"events_history"`     // empty if the lookup failed, see GetMaintenanceEventsHistory
+}
+
+func init() {
+	cloudprovider.RegisterDetails(cloudprovider.CloudProvider_Aws, func() cloudprovider.ProviderDetails { return &AdditionalInfo{} })
+}
+
+// Returns the AWS details of info, nil if info was not produced by the AWS provider
+func GetDetails(info *cloudprovider.MachineInfo) *AdditionalInfo {
+	details, _ := info.Details.(*AdditionalInfo)
+	return details
 }
 
 func (info *AdditionalInfo) ToArr() (arr []cloudprovider.AdditionalParam) {
 
 	arr = []cloudprovider.AdditionalParam{
-		{"InstanceType", info.InstanceType},
-		{"GroupName", info.GroupName},
-		{"ImageID", info.ImageID},
-		{"MACs", fmt.Sprintf("%v", info.Macs)},
-		{"AccountID", info.AccountID},
-		{"BillingProducts", fmt.Sprintf("%v", info.BillingProducts)},
-		{"MarketplaceProductCodes", fmt.Sprintf("%v", info.MarketplaceProductCodes)},
+		{Key: "InstanceType", Value: info.InstanceType},
+		{Key: "GroupName", Value: info.GroupName},
+		{Key: "ImageID", Value: info.ImageID},
+		{Key: "MACs", Value: fmt.Sprintf("%v", info.Macs)},
+		{Key: "AccountID", Value: info.AccountID},
+		{Key: "BillingProducts", Value: fmt.Sprintf("%v", info.BillingProducts)},
+		{Key: "MarketplaceProductCodes", Value: fmt.Sprintf("%v", info.MarketplaceProductCodes)},
+		{Key: "Volumes", Value: fmt.Sprintf("%v", info.Volumes)},
+		{Key: "ScheduledEvents", Value: fmt.Sprintf("%v", info.ScheduledEvents)},
+		{Key: "EventsHistory", Value: fmt.Sprintf("%v", info.EventsHistory)},
 	}
 	return
 }
 
 type MacInfo struct {
-	Address          string
-	VpcID            string
-	SubnetID         string
-	SecurityGroupIds string
+	Address          string `json:"address" yaml:"address"`
+	VpcID            string `json:"vpc_id" yaml:"vpc_id"`
+	SubnetID         string `json:"subnet_id" yaml:"subnet_id"`
+	SecurityGroupIds string `json:"security_group_ids" yaml:"security_group_ids"`
 }
 
 func (info *MacInfo) String() string {
@@ -47,30 +65,50 @@ func (info *MacInfo) String() string {
 }
 
 type AmzServiceProvider struct {
-	client *amz_client
+	client       *amz_client
+	identifyNVMe NVMeIdentifyFunc
+	imdsOptions  util.IMDSClientOptions
 }
 
-var _ cloudprovider.ICloudProviderVirtualMachine = (*AmzServiceProvider)(nil)
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*AmzServiceProvider)(nil)
 
 func NewAmzServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
-	p := &AmzServiceProvider{}
+	p := &AmzServiceProvider{identifyNVMe: identifyNVMeController}
 	return p
 }
 
+// Same as NewAmzServiceProvider, with the endpoint, address family or retries of IMDS set in code
+func NewAmzServiceProviderWithIMDS(opts util.IMDSClientOptions) cloudprovider.ICloudProviderVirtualMachine {
+	return &AmzServiceProvider{identifyNVMe: identifyNVMeController, imdsOptions: opts}
+}
+
 func (provider *AmzServiceProvider) GetName() cloudprovider.CloudProviderType {
 	return cloudprovider.CloudProvider_Aws
 }
 
 func (provider *AmzServiceProvider) Init() (err error) {
+	return provider.InitContext(context.Background())
+}
 
-	provider.client, err = NewClient()
-	return
+func (provider *AmzServiceProvider) InitContext(ctx context.Context) (err error) {
+
+	client, err := newClient(ctx, util.NewIMDSClient(provider.imdsOptions))
+	if err != nil {
+		// a failed refresh keeps the client of the previous Init
+		return err
+	}
+	provider.client = client
+	return nil
 }
 
 func (provider *AmzServiceProvider) GetMachineInfo() (info *cloudprovider.MachineInfo, err error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *AmzServiceProvider) GetMachineInfoContext(ctx context.Context) (info *cloudprovider.MachineInfo, err error) {
 
 	if !provider.isValid() {
-		return nil, errors.New("Not supported")
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
 	}
 
 	instanceDoc := provider.client.doc
@@ -78,8 +116,13 @@ func (provider *AmzServiceProvider) GetMachineInfo() (info *cloudprovider.Machin
 		return
 	}
 
-	macs, _ := provider.GetMacsInfo()
-	groupName, _ := provider.client.GetMetadata("placement/group-name")
+	macs, _ := provider.GetMacsInfoContext(ctx)
+	groupName, _ := provider.client.GetMetadataContext(ctx, "placement/group-name")
+	mapping, _ := provider.getBlockDeviceMappingContext(ctx)
+	disks := cloudprovider.GetBlockDevices()
+	// the events are optional details, a failed lookup leaves them empty instead of failing MachineInfo
+	scheduledEvents, _ := provider.GetScheduledMaintenanceEventsContext(ctx)
+	eventsHistory, _ := provider.GetMaintenanceEventsHistoryContext(ctx)
 
 	additionalInfo := &AdditionalInfo{
 		InstanceType:            instanceDoc.InstanceType,
@@ -89,11 +132,19 @@ func (provider *AmzServiceProvider) GetMachineInfo() (info *cloudprovider.Machin
 		AccountID:               instanceDoc.AccountID,
 		BillingProducts:         instanceDoc.BillingProducts,
 		MarketplaceProductCodes: instanceDoc.MarketplaceProductCodes,
+		Volumes:                 classifyVolumes(disks, mapping, provider.identifyNVMe),
+		ScheduledEvents:         scheduledEvents,
+		EventsHistory:           eventsHistory,
 	}
 
-	dnsName, _ := provider.client.GetMetadata("public-hostname")
+	dnsName, _ := provider.client.GetMetadataContext(ctx, "public-hostname")
+	if err = ctx.Err(); err != nil {
+		// the lookups above ignore their errors, don't return partial info on cancellation
+		return nil, err
+	}
 
 	info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
 		InstanceID:   instanceDoc.InstanceID,
 		Zone:         instanceDoc.AvailabilityZone,
 		Region:       instanceDoc.Region,
@@ -101,7 +152,9 @@ func (provider *AmzServiceProvider) GetMachineInfo() (info *cloudprovider.Machin
 		IPAddresses:  []string{instanceDoc.PrivateIP},
 		PublicDNS:    dnsName,
 		Cluster:      provider.getCluster(),
+		Disks:        disks,
 		Additional:   additionalInfo.ToArr(),
+		Details:      additionalInfo,
 	}
 
 	return
@@ -116,17 +169,21 @@ func (provider *AmzServiceProvider) GetVirtualMachineID() (instanceId string, er
 // http://169.254.169.254/latest/meta-data/network/interfaces/macs/12:85:18:5e:fc:eb/subnet-id
 // curl http://169.254.169.254/latest/meta-data/network/interfaces/macs/12:85:18:5e:fc:eb/security-group-ids
 func (provider *AmzServiceProvider) GetMacsInfo() (info []*MacInfo, err error) {
+	return provider.GetMacsInfoContext(context.Background())
+}
+
+func (provider *AmzServiceProvider) GetMacsInfoContext(ctx context.Context) (info []*MacInfo, err error) {
 	// info = make([]MacInfo, 0, 1)
-	macsStr, err := provider.client.GetMetadata("network/interfaces/macs")
+	macsStr, err := provider.client.GetMetadataContext(ctx, "network/interfaces/macs")
 	if err == nil {
 		macs := strings.Split(macsStr, "/")
 		for _, address := range macs {
 			if address == "" {
 				continue
 			}
-			vpcid, _ := provider.client.GetMetadata(fmt.Sprintf(`network/interfaces/macs/%v/vpc-id`, address))
-			subnetID, _ := provider.client.GetMetadata(fmt.Sprintf(`network/interfaces/macs/%v/subnet-id`, address))
-			securityGroupIDs, _ := provider.client.GetMetadata(fmt.Sprintf(`network/interfaces/macs/%v/security-group-ids`, address))
+			vpcid, _ := provider.client.GetMetadataContext(ctx, fmt.Sprintf(`network/interfaces/macs/%v/vpc-id`, address))
+			subnetID, _ := provider.client.GetMetadataContext(ctx, fmt.Sprintf(`network/interfaces/macs/%v/subnet-id`, address))
+			securityGroupIDs, _ := provider.client.GetMetadataContext(ctx, fmt.Sprintf(`network/interfaces/macs/%v/security-group-ids`, address))
 			info = append(info, &MacInfo{Address: address, VpcID: vpcid, SubnetID: subnetID, SecurityGroupIds: securityGroupIDs})
 		}
 	}
@@ -0,0 +1,54 @@
+package amz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+)
+
+var _ cloudprovider.IAttester = (*AmzServiceProvider)(nil)
+
+// Returns the signed instance identity document, verify it with VerifyAttestationBundle.
+// The document does not include the nonce
+func (provider *AmzServiceProvider) AttestIdentity(ctx context.Context, nonce string) (*cloudprovider.AttestationBundle, error) {
+	if !provider.isValid() {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	document, err := provider.client.query(ctx, "dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := provider.client.query(ctx, "dynamic/instance-identity/signature")
+	if err != nil {
+		return nil, err
+	}
+	var doc ec2metadata.EC2InstanceIdentityDocument
+	if err = json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("%w: invalid instance identity document: %v", cloudprovider.ErrNotDetected, err)
+	}
+
+	bundle := cloudprovider.NewAttestationBundle(provider.GetName(), cloudprovider.AttestationFormat_AWSIdentityDocument, nonce, doc.InstanceID)
+	bundle.Document = document
+	bundle.Signature = strings.Join(strings.Fields(string(signature)), "")
+	return bundle, nil
+}
+
+// Verifies the signature of an AWS bundle and that it names the document's instance
+func VerifyAttestationBundle(bundle *cloudprovider.AttestationBundle, verifier *IdentityVerifier) (*VerifiedIdentityDocument, error) {
+	if bundle.Format != cloudprovider.AttestationFormat_AWSIdentityDocument {
+		return nil, fmt.Errorf("%w: %v bundle is not an AWS identity document", cloudprovider.ErrInvalidConfig, bundle.Format)
+	}
+	document, err := verifier.Verify(bundle.Document, bundle.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if document.InstanceID != bundle.InstanceID {
+		return nil, fmt.Errorf("%w: bundle of %v holds the identity document of %v", cloudprovider.ErrAttestationMismatch,
+			bundle.InstanceID, document.InstanceID)
+	}
+	return document, nil
+}
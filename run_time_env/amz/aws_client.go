@@ -1,45 +1,35 @@
 package amz
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"strconv"
-	"time"
 
+	"github.com/VolumezTech/volumez-cloud-provider/util"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 )
 
-type tokenInfo struct {
-	Value           string
-	TokenExpiration time.Time
+// Caches the instance identity document, the requests go through the shared IMDS client
+type amz_client struct {
+	imds *util.IMDSClient
+	doc  *ec2metadata.EC2InstanceIdentityDocument // cached data
 }
 
-func (t *tokenInfo) IsValid() bool {
-	return t.TokenExpiration.After(time.Now())
-}
-func NewToken(value string, expirationTime int) *tokenInfo {
-	return &tokenInfo{Value: value, TokenExpiration: time.Now().Add(time.Second * time.Duration(expirationTime))}
+func NewClient() (client *amz_client, err error) {
+	return NewClientContext(context.Background())
 }
 
-const (
-	tokenExpirationInSeconds = 6 * 3600
-	numberOfRetries          = 3
-)
-
-type amz_client struct {
-	Token *tokenInfo
-	doc   *ec2metadata.EC2InstanceIdentityDocument // cached data
+func NewClientContext(ctx context.Context) (client *amz_client, err error) {
+	return newClient(ctx, newIMDSClient())
 }
 
-func NewClient() (client *amz_client, err error) {
-	// on EC2 this may fail, but then nil token will work fine
-	t, _ := retrieveSecurityToken(3, tokenExpirationInSeconds)
+func newIMDSClient() *util.IMDSClient {
+	return util.NewIMDSClient(util.IMDSClientOptions{})
+}
 
-	c := amz_client{Token: t}
-	doc, err := c.getInstanceIdentityDocument()
+func newClient(ctx context.Context, imds *util.IMDSClient) (client *amz_client, err error) {
+	c := amz_client{imds: imds}
+	doc, err := c.getInstanceIdentityDocument(ctx)
 	if err == nil {
 		c.doc = &doc
 		client = &c
@@ -47,112 +37,42 @@ func NewClient() (client *amz_client, err error) {
 	return
 }
 
-func (client *amz_client) getToken() (token string, err error) {
-
-	if client.Token == nil {
-		err = errors.New("token is not required")
-		return
-	}
-	if !client.Token.IsValid() {
-		var t *tokenInfo
-		t, err = retrieveSecurityToken(3, tokenExpirationInSeconds)
-		client.Token = t
-	}
-	if client.Token != nil {
-		token = client.Token.Value
-	}
-	return
-}
-
 func (client *amz_client) GetMetadata(name string) (data string, err error) {
-	resp, err := client.query(fmt.Sprintf(`meta-data/%v`, name))
-	data = string(resp)
-	return
+	return client.GetMetadataContext(context.Background(), name)
 }
 
-func (client *amz_client) query(name string) (resp []byte, err error) {
-
-	url := formatURL(name)
-	request, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return
-	}
-
-	token, err := client.getToken()
-	if err == nil {
-		request.Header.Add("X-aws-ec2-metadata-token", token)
-	}
-	resp, err = processRequest(request)
-	return
+func (client *amz_client) GetMetadataContext(ctx context.Context, name string) (data string, err error) {
+	return client.imds.GetMetadata(ctx, name)
 }
 
-func (client *amz_client) GetInstanceIdentityDocument() (doc ec2metadata.EC2InstanceIdentityDocument, err error) {
-	if client.doc != nil {
-		doc = *client.doc
-	} else {
-		doc, err = client.getInstanceIdentityDocument()
-	}
-	return
+func (client *amz_client) query(ctx context.Context, name string) (resp []byte, err error) {
+	return client.imds.Get(ctx, name)
 }
 
-func (client *amz_client) getInstanceIdentityDocument() (doc ec2metadata.EC2InstanceIdentityDocument, err error) {
-	resp, err := client.query("dynamic/instance-identity/document")
-
-	if err == nil {
-		err = json.Unmarshal(resp, &doc)
-	}
-	return
+func (client *amz_client) GetInstanceIdentityDocument() (doc ec2metadata.EC2InstanceIdentityDocument, err error) {
+	return client.GetInstanceIdentityDocumentContext(context.Background())
 }
 
-func processRequest(request *http.Request) (response []byte, err error) {
-
-	resp, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		err = fmt.Errorf(`req={%v %v %v}  resp={%v %v}`, request.Method, request.URL, request.Header, resp.Status, resp.Header)
+func (client *amz_client) GetInstanceIdentityDocumentContext(ctx context.Context) (doc ec2metadata.EC2InstanceIdentityDocument, err error) {
+	if client.doc != nil {
+		doc = *client.doc
 	} else {
-		response = body
+		doc, err = client.getInstanceIdentityDocument(ctx)
 	}
 	return
 }
 
-func retrieveSecurityTokenOnce(expirationTime int) (t *tokenInfo, err error) {
-	request, err := http.NewRequest(http.MethodPut, formatURL("api/token"), nil)
-	if err != nil {
-		return
-	}
-	request.Header.Add("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(expirationTime))
+func (client *amz_client) getInstanceIdentityDocument(ctx context.Context) (doc ec2metadata.EC2InstanceIdentityDocument, err error) {
+	resp, err := client.query(ctx, "dynamic/instance-identity/document")
 
-	body, err := processRequest(request)
 	if err == nil {
-		t = NewToken(string(body), expirationTime)
-	}
-	return
-}
-
-func retrieveSecurityToken(numberOfRetries int, expirationTime int) (t *tokenInfo, err error) {
-	for i := 0; i < numberOfRetries; i++ {
-		t, err = retrieveSecurityTokenOnce(expirationTime)
-		if err == nil {
-			return
+		if err = json.Unmarshal(resp, &doc); err != nil {
+			err = fmt.Errorf("%w: invalid instance identity document: %v", util.ErrNotDetected, err)
 		}
 	}
 	return
 }
 
-func formatURL(relativePath string) string {
-	return fmt.Sprintf(`http://169.254.169.254/latest/%v`, relativePath)
-}
-
 // type amz_ec2_client struct {
 // 	ec2Metadata *ec2metadata.EC2Metadata
 // }
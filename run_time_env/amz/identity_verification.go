@@ -0,0 +1,142 @@
+package amz
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+)
+
+const defaultCertificateName = "default"
+
+// The instance identity document with the signature it was verified with
+type VerifiedIdentityDocument struct {
+	ec2metadata.EC2InstanceIdentityDocument
+	Raw       []byte // the document as signed
+	Signature []byte
+}
+
+// Verifies instance identity documents against the AWS public certificates.
+// The certificates are published per region in the EC2 user guide ("Verify the instance identity
+// document"), most regions share one. Certificates are not bundled, callers configure them
+type IdentityVerifier struct {
+	mutex        sync.RWMutex
+	certificates map[string]*x509.Certificate // region -> certificate, defaultCertificateName for the others
+}
+
+func NewIdentityVerifier() *IdentityVerifier {
+	return &IdentityVerifier{certificates: map[string]*x509.Certificate{}}
+}
+
+// Sets the certificate of a region, an empty region sets the certificate of the regions without one
+func (verifier *IdentityVerifier) AddCertificatePEM(region string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("%w: AWS certificate for %v: no PEM certificate", cloudprovider.ErrInvalidConfig, regionName(region))
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: AWS certificate for %v: %v", cloudprovider.ErrInvalidConfig, regionName(region), err)
+	}
+	if region == "" {
+		region = defaultCertificateName
+	}
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	verifier.certificates[region] = certificate
+	return nil
+}
+
+// Loads <region>.pem files from dir, default.pem applies to regions without their own file
+func (verifier *IdentityVerifier) LoadCertificatesDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("%w: no AWS certificates in %v", cloudprovider.ErrInvalidConfig, dir)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		region := strings.TrimSuffix(filepath.Base(file), ".pem")
+		if region == defaultCertificateName {
+			region = ""
+		}
+		if err = verifier.AddCertificatePEM(region, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verifies the base64 RSA SHA-256 signature of dynamic/instance-identity/signature
+// with the certificate of the region named in the document
+func (verifier *IdentityVerifier) Verify(document []byte, signature string) (*VerifiedIdentityDocument, error) {
+	verified := &VerifiedIdentityDocument{Raw: document}
+	if err := json.Unmarshal(document, &verified.EC2InstanceIdentityDocument); err != nil {
+		return nil, fmt.Errorf("%w: invalid instance identity document: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signature), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: instance identity signature is not base64: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	verified.Signature = sig
+
+	certificate := verifier.getCertificate(verified.Region)
+	if certificate == nil {
+		return nil, fmt.Errorf("%w: no AWS certificate configured for %v", cloudprovider.ErrUntrustedCertificate, regionName(verified.Region))
+	}
+	if err = certificate.CheckSignature(x509.SHA256WithRSA, document, sig); err != nil {
+		return nil, fmt.Errorf("%w: instance identity document of %v: %v", cloudprovider.ErrInvalidSignature, verified.InstanceID, err)
+	}
+	return verified, nil
+}
+
+func (verifier *IdentityVerifier) getCertificate(region string) *x509.Certificate {
+	verifier.mutex.RLock()
+	defer verifier.mutex.RUnlock()
+	if certificate, ok := verifier.certificates[region]; ok {
+		return certificate
+	}
+	return verifier.certificates[defaultCertificateName]
+}
+
+func regionName(region string) string {
+	if region == "" {
+		return "the other regions"
+	}
+	return region
+}
+
+// Fetches the identity document and its signature and verifies them
+func (provider *AmzServiceProvider) GetVerifiedIdentityDocument(verifier *IdentityVerifier) (*VerifiedIdentityDocument, error) {
+	return provider.GetVerifiedIdentityDocumentContext(context.Background(), verifier)
+}
+
+func (provider *AmzServiceProvider) GetVerifiedIdentityDocumentContext(ctx context.Context, verifier *IdentityVerifier) (*VerifiedIdentityDocument, error) {
+	if !provider.isValid() {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	// the document is fetched again, the signature covers its exact bytes
+	document, err := provider.client.query(ctx, "dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := provider.client.query(ctx, "dynamic/instance-identity/signature")
+	if err != nil {
+		return nil, err
+	}
+	return verifier.Verify(document, string(signature))
+}
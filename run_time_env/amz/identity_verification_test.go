@@ -0,0 +1,179 @@
+package amz
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+const testIdentityDocument = `{
+  "accountId" : "123456789012",
+  "architecture" : "x86_64",
+  "availabilityZone" : "eu-west-1a",
+  "imageId" : "ami-0123456789abcdef0",
+  "instanceId" : "i-0123456789abcdef0",
+  "instanceType" : "i4i.4xlarge",
+  "privateIp" : "10.0.0.7",
+  "region" : "eu-west-1",
+  "version" : "2017-09-30"
+}`
+
+type testSigner struct {
+	key  *rsa.PrivateKey
+	cert []byte // PEM
+}
+
+func newTestSigner(t *testing.T, name string) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{name}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{key: key, cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (signer *testSigner) sign(t *testing.T, document string) string {
+	digest := sha256.Sum256([]byte(document))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestIdentityVerifier(t *testing.T) {
+	aws := newTestSigner(t, "Amazon Web Services LLC")
+	other := newTestSigner(t, "Someone else")
+	signature := aws.sign(t, testIdentityDocument)
+
+	verifier := NewIdentityVerifier()
+	if _, err := verifier.Verify([]byte(testIdentityDocument), signature); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+		t.Errorf("without certificates: %v", err)
+	}
+
+	if err := verifier.AddCertificatePEM("", aws.cert); err != nil {
+		t.Fatal(err)
+	}
+	verified, err := verifier.Verify([]byte(testIdentityDocument), signature[:40]+"\n"+signature[40:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.InstanceID != "i-0123456789abcdef0" || verified.Region != "eu-west-1" {
+		t.Errorf("verified = %+v", verified.EC2InstanceIdentityDocument)
+	}
+
+	tampered := []byte(testIdentityDocument)
+	tampered[len(tampered)-5] = '8'
+	if _, err := verifier.Verify(tampered, signature); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("tampered document: %v", err)
+	}
+
+	// the region specific certificate takes precedence over the default one
+	if err := verifier.AddCertificatePEM("eu-west-1", other.cert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify([]byte(testIdentityDocument), signature); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("wrong region certificate: %v", err)
+	}
+
+	if err := verifier.AddCertificatePEM("eu-west-1", []byte("not a certificate")); !errors.Is(err, cloudprovider.ErrInvalidConfig) {
+		t.Errorf("invalid PEM: %v", err)
+	}
+}
+
+func TestGetVerifiedIdentityDocument(t *testing.T) {
+	aws := newTestSigner(t, "Amazon Web Services LLC")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "eu-west-1.pem"), aws.cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewIdentityVerifier()
+	if err := verifier.LoadCertificatesDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	signature := aws.sign(t, testIdentityDocument)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(testIdentityDocument))
+		case "/latest/dynamic/instance-identity/signature":
+			w.Write([]byte(signature))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	verified, err := provider.GetVerifiedIdentityDocument(verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.AccountID != "123456789012" || string(verified.Raw) != testIdentityDocument {
+		t.Errorf("verified = %+v", verified)
+	}
+}
+
+func TestAttestIdentity(t *testing.T) {
+	aws := newTestSigner(t, "Amazon Web Services LLC")
+	signature := aws.sign(t, testIdentityDocument)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(testIdentityDocument))
+		case "/latest/dynamic/instance-identity/signature":
+			w.Write([]byte(signature[:64] + "\n" + signature[64:] + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	bundle, err := cloudprovider.Attest(context.Background(), provider, "enroll-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Format != cloudprovider.AttestationFormat_AWSIdentityDocument || bundle.InstanceID != "i-0123456789abcdef0" ||
+		bundle.Nonce != "enroll-42" || bundle.Signature != signature {
+		t.Errorf("bundle = %+v", bundle)
+	}
+
+	verifier := NewIdentityVerifier()
+	if err = verifier.AddCertificatePEM("", aws.cert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifyAttestationBundle(bundle, verifier); err != nil {
+		t.Error(err)
+	}
+	bundle.InstanceID = "i-0fedcba9876543210"
+	if _, err = VerifyAttestationBundle(bundle, verifier); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("other instance: %v", err)
+	}
+}
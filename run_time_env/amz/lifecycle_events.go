@@ -0,0 +1,79 @@
+package amz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+var _ cloudprovider.ILifecycleEventSource = (*AmzServiceProvider)(nil)
+
+// Watches the spot interruption and rebalance notices and the active scheduled maintenance events
+func (provider *AmzServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	imds := util.NewIMDSClient(provider.imdsOptions)
+	if provider.isValid() {
+		imds = provider.client.imds
+	}
+	watcher := newSpotWatcher(imds, SpotWatcherOptions{})
+	seen := map[string]bool{}
+
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+	for {
+		for _, event := range watcher.poll(ctx) {
+			handler(interruptionToLifecycleEvent(event))
+		}
+		// failures are retried on the next poll
+		events, _ := getMaintenanceEvents(ctx, watcher.client, "events/maintenance/scheduled")
+		for _, event := range events {
+			if event.State == MaintenanceEventState_Active && !seen[event.EventID] {
+				seen[event.EventID] = true
+				handler(maintenanceToLifecycleEvent(event))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func interruptionToLifecycleEvent(event *InterruptionEvent) *cloudprovider.LifecycleEvent {
+	lifecycleEvent := &cloudprovider.LifecycleEvent{
+		Provider:  cloudprovider.CloudProvider_Aws,
+		Type:      cloudprovider.LifecycleEvent_Rebalance,
+		NotBefore: event.Time,
+		Source:    event,
+	}
+	if event.Type == InterruptionEvent_Spot {
+		lifecycleEvent.Type = cloudprovider.LifecycleEvent_Preemption
+		lifecycleEvent.Description = fmt.Sprintf("spot instance %v", event.Action)
+	} else {
+		// noticeTime is when the recommendation was issued
+		lifecycleEvent.NotBefore = time.Time{}
+		lifecycleEvent.Description = "rebalance recommendation"
+	}
+	return lifecycleEvent
+}
+
+func maintenanceToLifecycleEvent(event *MaintenanceEvent) *cloudprovider.LifecycleEvent {
+	eventType := cloudprovider.LifecycleEvent_Maintenance
+	switch event.Code {
+	case MaintenanceEvent_InstanceReboot, MaintenanceEvent_SystemReboot:
+		eventType = cloudprovider.LifecycleEvent_Reboot
+	case MaintenanceEvent_InstanceRetirement, MaintenanceEvent_InstanceStop:
+		eventType = cloudprovider.LifecycleEvent_Retirement
+	}
+	return &cloudprovider.LifecycleEvent{
+		Provider:    cloudprovider.CloudProvider_Aws,
+		Type:        eventType,
+		ID:          event.EventID,
+		NotBefore:   event.NotBefore,
+		Description: event.Description,
+		Source:      event,
+	}
+}
@@ -0,0 +1,126 @@
+package amz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+// Scheduled event codes, see https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/monitoring-instances-status-check_sched.html
+const (
+	MaintenanceEvent_InstanceReboot     = "instance-reboot"
+	MaintenanceEvent_SystemReboot       = "system-reboot"
+	MaintenanceEvent_SystemMaintenance  = "system-maintenance"
+	MaintenanceEvent_InstanceRetirement = "instance-retirement"
+	MaintenanceEvent_InstanceStop       = "instance-stop"
+
+	MaintenanceEventState_Active    = "active"
+	MaintenanceEventState_Completed = "completed"
+	MaintenanceEventState_Canceled  = "canceled"
+
+	maintenanceEventTimeLayout = "2 Jan 2006 15:04:05 GMT"
+)
+
+type MaintenanceEvent struct {
+	EventID           string    `json:"event_id" yaml:"event_id"`
+	Code              string    `json:"code" yaml:"code"` // MaintenanceEvent_...
+	Description       string    `json:"description" yaml:"description"`
+	State             string    `json:"state" yaml:"state"` // MaintenanceEventState_...
+	NotBefore         time.Time `json:"not_before" yaml:"not_before"`
+	NotAfter          time.Time `json:"not_after" yaml:"not_after"`                     // zero if the event has no end time
+	NotBeforeDeadline time.Time `json:"not_before_deadline" yaml:"not_before_deadline"` // latest time the event can be rescheduled to
+}
+
+func (event *MaintenanceEvent) String() string {
+	return fmt.Sprintf(`{%v  Code: %v  State: %v  NotBefore: %v  NotAfter: %v}`, event.EventID, event.Code, event.State,
+		event.NotBefore.Format(time.RFC3339), event.NotAfter.Format(time.RFC3339))
+}
+
+// Returns true for events that take the instance or its instance store away for good
+func (event *MaintenanceEvent) IsRetirement() bool {
+	return event.Code == MaintenanceEvent_InstanceRetirement || event.Code == MaintenanceEvent_InstanceStop
+}
+
+// As returned by IMDS, times are formatted like "21 Jan 2019 09:00:43 GMT"
+type maintenanceEventMetadata struct {
+	EventID           string `json:"EventId"`
+	Code              string `json:"Code"`
+	Description       string `json:"Description"`
+	State             string `json:"State"`
+	NotBefore         string `json:"NotBefore"`
+	NotAfter          string `json:"NotAfter"`
+	NotBeforeDeadline string `json:"NotBeforeDeadline"`
+}
+
+func parseMaintenanceEvents(data string) (events []*MaintenanceEvent, err error) {
+	var list []maintenanceEventMetadata
+	if err = json.Unmarshal([]byte(data), &list); err != nil {
+		return nil, fmt.Errorf("invalid maintenance events: %w", err)
+	}
+	events = []*MaintenanceEvent{}
+	for _, item := range list {
+		event := &MaintenanceEvent{EventID: item.EventID, Code: item.Code, Description: item.Description, State: item.State}
+		for _, field := range []struct {
+			value  string
+			target *time.Time
+		}{
+			{item.NotBefore, &event.NotBefore},
+			{item.NotAfter, &event.NotAfter},
+			{item.NotBeforeDeadline, &event.NotBeforeDeadline},
+		} {
+			if field.value == "" {
+				continue
+			}
+			if *field.target, err = time.Parse(maintenanceEventTimeLayout, field.value); err != nil {
+				return nil, fmt.Errorf("invalid maintenance event %v: %w", item.EventID, err)
+			}
+		}
+		events = append(events, event)
+	}
+	return
+}
+
+// http://169.254.169.254/latest/meta-data/events/maintenance/scheduled
+func (provider *AmzServiceProvider) GetScheduledMaintenanceEvents() ([]*MaintenanceEvent, error) {
+	return provider.GetScheduledMaintenanceEventsContext(context.Background())
+}
+
+func (provider *AmzServiceProvider) GetScheduledMaintenanceEventsContext(ctx context.Context) ([]*MaintenanceEvent, error) {
+	return provider.getMaintenanceEvents(ctx, "events/maintenance/scheduled")
+}
+
+// http://169.254.169.254/latest/meta-data/events/maintenance/history, completed and canceled events
+func (provider *AmzServiceProvider) GetMaintenanceEventsHistory() ([]*MaintenanceEvent, error) {
+	return provider.GetMaintenanceEventsHistoryContext(context.Background())
+}
+
+func (provider *AmzServiceProvider) GetMaintenanceEventsHistoryContext(ctx context.Context) ([]*MaintenanceEvent, error) {
+	return provider.getMaintenanceEvents(ctx, "events/maintenance/history")
+}
+
+func (provider *AmzServiceProvider) getMaintenanceEvents(ctx context.Context, name string) ([]*MaintenanceEvent, error) {
+	if !provider.isValid() {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	return getMaintenanceEvents(ctx, provider.client, name)
+}
+
+func getMaintenanceEvents(ctx context.Context, client *amz_client, name string) ([]*MaintenanceEvent, error) {
+	data, err := client.GetMetadataContext(ctx, name)
+	var metadataErr *cloudprovider.MetadataError
+	if errors.As(err, &metadataErr) && metadataErr.StatusCode == 404 {
+		// not listed until there was an event
+		return []*MaintenanceEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return []*MaintenanceEvent{}, nil
+	}
+	return parseMaintenanceEvents(data)
+}
@@ -0,0 +1,85 @@
+package amz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScheduledEvents = `[
+	{
+		"NotBefore": "21 Jan 2027 09:00:43 GMT",
+		"Code": "instance-retirement",
+		"Description": "The instance is running on degraded hardware",
+		"EventId": "instance-event-0d59937288b749b32",
+		"NotAfter": "21 Jan 2027 09:17:23 GMT",
+		"State": "active"
+	},
+	{
+		"NotBefore": "28 Jan 2027 02:00:00 GMT",
+		"Code": "system-reboot",
+		"Description": "scheduled reboot",
+		"EventId": "instance-event-0e64c7eb0d9be7b1a",
+		"NotBeforeDeadline": "4 Feb 2027 02:00:00 GMT",
+		"State": "active"
+	}
+]`
+
+func TestMaintenanceEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/meta-data/events/maintenance/scheduled":
+			w.Write([]byte(testScheduledEvents))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	events, err := provider.GetScheduledMaintenanceEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %v", events)
+	}
+	retirement := events[0]
+	if retirement.EventID != "instance-event-0d59937288b749b32" || !retirement.IsRetirement() || retirement.State != MaintenanceEventState_Active {
+		t.Errorf("retirement = %v", retirement)
+	}
+	if !retirement.NotBefore.Equal(time.Date(2027, 1, 21, 9, 0, 43, 0, time.UTC)) || !retirement.NotAfter.Equal(time.Date(2027, 1, 21, 9, 17, 23, 0, time.UTC)) {
+		t.Errorf("retirement window = %v - %v", retirement.NotBefore, retirement.NotAfter)
+	}
+	reboot := events[1]
+	if reboot.IsRetirement() || !reboot.NotAfter.IsZero() || !reboot.NotBeforeDeadline.Equal(time.Date(2027, 2, 4, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("reboot = %+v", reboot)
+	}
+
+	// no history yet
+	history, err := provider.GetMaintenanceEventsHistory()
+	if err != nil || len(history) != 0 {
+		t.Errorf("history = %v, %v", history, err)
+	}
+}
+
+func TestParseMaintenanceEventsRejectsBadTime(t *testing.T) {
+	if _, err := parseMaintenanceEvents(`[{"EventId": "e1", "NotBefore": "2027-01-21T09:00:43Z"}]`); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestAdditionalInfoListsEventsHistory(t *testing.T) {
+	info := &AdditionalInfo{EventsHistory: []*MaintenanceEvent{{EventID: "instance-event-0d59937288b749b32"}}}
+	for _, param := range info.ToArr() {
+		if param.Key == "EventsHistory" {
+			if !strings.Contains(param.Value, "instance-event-0d59937288b749b32") {
+				t.Errorf("EventsHistory = %v", param.Value)
+			}
+			return
+		}
+	}
+	t.Error("ToArr() has no EventsHistory")
+}
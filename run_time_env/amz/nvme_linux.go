@@ -0,0 +1,62 @@
+//go:build linux
+
+package amz
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	nvmeAdminIdentify     = 0x06
+	nvmeIdentifyCNSCtrl   = 1
+	nvmeIdentifyDataSize  = 4096
+	nvmeIoctlAdminCommand = 0xC0484E41 // _IOWR('N', 0x41, struct nvme_admin_cmd)
+)
+
+// struct nvme_admin_cmd from linux/nvme_ioctl.h
+type nvmeAdminCommand struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// Issues an NVMe identify controller admin command, requires CAP_SYS_ADMIN
+func identifyNVMeController(devicePath string) ([]byte, error) {
+	file, err := os.Open(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, nvmeIdentifyDataSize)
+	cmd := nvmeAdminCommand{
+		opcode:  nvmeAdminIdentify,
+		addr:    uint64(uintptr(unsafe.Pointer(&data[0]))),
+		dataLen: nvmeIdentifyDataSize,
+		cdw10:   nvmeIdentifyCNSCtrl,
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), nvmeIoctlAdminCommand, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(data)
+	if errno != 0 {
+		return nil, errno
+	}
+	return data, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package amz
+
+import (
+	"fmt"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+func identifyNVMeController(devicePath string) ([]byte, error) {
+	return nil, fmt.Errorf("NVMe identify %v: %w", devicePath, cloudprovider.ErrUnimplemented)
+}
@@ -0,0 +1,158 @@
+package amz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+type InterruptionEventType string
+
+const (
+	InterruptionEvent_Spot      InterruptionEventType = "spot-interruption"
+	InterruptionEvent_Rebalance InterruptionEventType = "rebalance-recommendation"
+
+	// AWS gives a two minutes spot interruption notice, poll well within it
+	DefaultSpotPollInterval = 5 * time.Second
+	spotEventsBufferSize    = 8
+)
+
+type InterruptionEvent struct {
+	Type   InterruptionEventType
+	Action string    // spot only: terminate, stop or hibernate
+	Time   time.Time // spot: when the action happens, rebalance: when the recommendation was issued
+}
+
+func (event *InterruptionEvent) String() string {
+	if event.Action != "" {
+		return fmt.Sprintf(`%v: %v at %v`, event.Type, event.Action, event.Time.Format(time.RFC3339))
+	}
+	return fmt.Sprintf(`%v at %v`, event.Type, event.Time.Format(time.RFC3339))
+}
+
+type SpotWatcherOptions struct {
+	PollInterval time.Duration // DefaultSpotPollInterval if zero
+	// Called for each new event instead of delivering it on Events()
+	OnEvent func(event *InterruptionEvent)
+	// Endpoint, address family, token TTL and retries of the IMDS client, as for NewAmzServiceProviderWithIMDS
+	IMDS util.IMDSClientOptions
+}
+
+// Polls meta-data/spot/instance-action and meta-data/events/recommendations/rebalance.
+// Each notice is delivered once, IMDS keeps returning it until the instance is interrupted
+type SpotWatcher struct {
+	client   *amz_client
+	interval time.Duration
+	onEvent  func(event *InterruptionEvent)
+	events   chan *InterruptionEvent
+	seen     map[InterruptionEvent]bool
+}
+
+func NewSpotWatcher(opts SpotWatcherOptions) *SpotWatcher {
+	return newSpotWatcher(util.NewIMDSClient(opts.IMDS), opts)
+}
+
+func newSpotWatcher(imds *util.IMDSClient, opts SpotWatcherOptions) *SpotWatcher {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultSpotPollInterval
+	}
+	return &SpotWatcher{
+		client:   &amz_client{imds: imds},
+		interval: opts.PollInterval,
+		onEvent:  opts.OnEvent,
+		events:   make(chan *InterruptionEvent, spotEventsBufferSize),
+		seen:     map[InterruptionEvent]bool{},
+	}
+}
+
+// Delivers the events when no OnEvent callback is set, closed when Run returns
+func (watcher *SpotWatcher) Events() <-chan *InterruptionEvent {
+	return watcher.events
+}
+
+// Polls until ctx is done, returns ctx.Err(). Run may be called once
+func (watcher *SpotWatcher) Run(ctx context.Context) error {
+	defer close(watcher.events)
+
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+	for {
+		for _, event := range watcher.poll(ctx) {
+			if err := watcher.deliver(ctx, event); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns the notices not returned before. Lookup failures are treated as no notice,
+// the next poll retries them
+func (watcher *SpotWatcher) poll(ctx context.Context) (events []*InterruptionEvent) {
+	if event := watcher.getSpotInterruption(ctx); event != nil && watcher.isNew(event) {
+		events = append(events, event)
+	}
+	if event := watcher.getRebalanceRecommendation(ctx); event != nil && watcher.isNew(event) {
+		events = append(events, event)
+	}
+	return
+}
+
+func (watcher *SpotWatcher) deliver(ctx context.Context, event *InterruptionEvent) error {
+	if watcher.onEvent != nil {
+		watcher.onEvent(event)
+		return nil
+	}
+	select {
+	case watcher.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (watcher *SpotWatcher) isNew(event *InterruptionEvent) bool {
+	if watcher.seen[*event] {
+		return false
+	}
+	watcher.seen[*event] = true
+	return true
+}
+
+// {"action": "terminate", "time": "2017-09-18T08:22:00Z"}, 404 when there is no interruption
+func (watcher *SpotWatcher) getSpotInterruption(ctx context.Context) *InterruptionEvent {
+	var notice struct {
+		Action string    `json:"action"`
+		Time   time.Time `json:"time"`
+	}
+	if !watcher.getNotice(ctx, "spot/instance-action", &notice) {
+		return nil
+	}
+	return &InterruptionEvent{Type: InterruptionEvent_Spot, Action: notice.Action, Time: notice.Time}
+}
+
+// {"noticeTime": "2020-10-27T08:22:00Z"}, 404 when there is no recommendation
+func (watcher *SpotWatcher) getRebalanceRecommendation(ctx context.Context) *InterruptionEvent {
+	var notice struct {
+		NoticeTime time.Time `json:"noticeTime"`
+	}
+	if !watcher.getNotice(ctx, "events/recommendations/rebalance", &notice) {
+		return nil
+	}
+	return &InterruptionEvent{Type: InterruptionEvent_Rebalance, Time: notice.NoticeTime}
+}
+
+func (watcher *SpotWatcher) getNotice(ctx context.Context, name string, notice interface{}) bool {
+	data, err := watcher.client.GetMetadataContext(ctx, name)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal([]byte(data), notice) == nil
+}
@@ -0,0 +1,120 @@
+package amz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+const testToken = "AQAEAFfakeToken=="
+
+// Local IMDS stand-in requiring IMDSv2 tokens. The spot notice appears after a few polls
+func newIMDSServer(t *testing.T, spotAfter int32) (*httptest.Server, *int32) {
+	var unauthorized int32
+	var spotPolls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(testToken))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != testToken {
+			atomic.AddInt32(&unauthorized, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/spot/instance-action":
+			if atomic.AddInt32(&spotPolls, 1) <= spotAfter {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"action": "terminate", "time": "2026-10-16T08:22:00Z"}`))
+		case "/latest/meta-data/events/recommendations/rebalance":
+			w.Write([]byte(`{"noticeTime": "2026-10-16T08:20:00Z"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &unauthorized
+}
+
+func newTestProvider(server *httptest.Server) *AmzServiceProvider {
+	return &AmzServiceProvider{client: &amz_client{imds: util.NewIMDSClient(util.IMDSClientOptions{Endpoint: server.URL})}}
+}
+
+func TestSpotWatcher(t *testing.T) {
+	server, unauthorized := newIMDSServer(t, 3)
+	watcher := newSpotWatcher(util.NewIMDSClient(util.IMDSClientOptions{Endpoint: server.URL}), SpotWatcherOptions{PollInterval: 5 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- watcher.Run(ctx) }()
+
+	events := []*InterruptionEvent{}
+	for event := range watcher.Events() {
+		events = append(events, event)
+	}
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("Run() = %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %v events, want the rebalance and the spot notice once each: %v", len(events), events)
+	}
+	rebalance, spot := events[0], events[1]
+	if rebalance.Type != InterruptionEvent_Rebalance || !rebalance.Time.Equal(time.Date(2026, 10, 16, 8, 20, 0, 0, time.UTC)) {
+		t.Errorf("rebalance = %v", rebalance)
+	}
+	if spot.Type != InterruptionEvent_Spot || spot.Action != "terminate" || !spot.Time.Equal(time.Date(2026, 10, 16, 8, 22, 0, 0, time.UTC)) {
+		t.Errorf("spot = %v", spot)
+	}
+	if *unauthorized != 0 {
+		t.Errorf("%v requests without a token", *unauthorized)
+	}
+}
+
+func TestSpotWatcherCallback(t *testing.T) {
+	server, _ := newIMDSServer(t, 0)
+	received := make(chan *InterruptionEvent, 10)
+	watcher := NewSpotWatcher(SpotWatcherOptions{
+		PollInterval: 5 * time.Millisecond,
+		OnEvent:      func(event *InterruptionEvent) { received <- event },
+		IMDS:         util.IMDSClientOptions{Endpoint: server.URL},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	watcher.Run(ctx)
+	if len(received) != 2 {
+		t.Errorf("callback got %v events, want 2", len(received))
+	}
+}
+
+func TestWatchLifecycleEvents(t *testing.T) {
+	server, _ := newIMDSServer(t, 0)
+	provider := newTestProvider(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	events := []*cloudprovider.LifecycleEvent{}
+	provider.WatchLifecycleEvents(ctx, func(event *cloudprovider.LifecycleEvent) { events = append(events, event) })
+
+	if len(events) != 2 || events[0].Type != cloudprovider.LifecycleEvent_Preemption || events[1].Type != cloudprovider.LifecycleEvent_Rebalance {
+		t.Fatalf("got %v", events)
+	}
+	if !events[0].NotBefore.Equal(time.Date(2026, 10, 16, 8, 22, 0, 0, time.UTC)) {
+		t.Errorf("preemption = %v", events[0])
+	}
+}
@@ -0,0 +1,117 @@
+package amz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+type VolumeType string
+
+const (
+	VolumeType_EBS           VolumeType = "ebs"
+	VolumeType_InstanceStore VolumeType = "instance-store"
+
+	ebsModel           = "Amazon Elastic Block Store"
+	instanceStoreModel = "Amazon EC2 NVMe Instance Storage"
+
+	// The EBS controller reports the requested device name (e.g. "sdf" or "/dev/sdf") in the
+	// vendor specific area of the NVMe identify controller data
+	nvmeVendorAreaOffset   = 3072
+	nvmeVendorDeviceLength = 32
+)
+
+// Returns the NVMe identify controller data (4096 bytes) of a device node
+type NVMeIdentifyFunc func(devicePath string) ([]byte, error)
+
+// A local NVMe device backed by EBS or instance storage
+type Volume struct {
+	Device      string     `json:"device" yaml:"device"`             // kernel name, e.g. nvme1n1
+	Type        VolumeType `json:"type" yaml:"type"`                 // ebs or instance-store
+	VolumeID    string     `json:"volume_id" yaml:"volume_id"`       // EBS volume id, e.g. vol-0123456789abcdef0
+	MappingName string     `json:"mapping_name" yaml:"mapping_name"` // device name requested at attach time, e.g. sdf
+	MappingKey  string     `json:"mapping_key" yaml:"mapping_key"`   // meta-data/block-device-mapping key, e.g. ebs1 or root
+}
+
+func (volume *Volume) String() string {
+	return fmt.Sprintf(`{%v  Type: %v  VolumeID: %v  Mapping: %v %v}`, volume.Device, volume.Type, volume.VolumeID, volume.MappingKey, volume.MappingName)
+}
+
+// "vol0123456789abcdef0" -> "vol-0123456789abcdef0"
+func volumeIDFromSerial(serial string) string {
+	if strings.HasPrefix(serial, "vol-") {
+		return serial
+	}
+	if strings.HasPrefix(serial, "vol") {
+		return "vol-" + strings.TrimPrefix(serial, "vol")
+	}
+	return ""
+}
+
+// Extracts the device name from the vendor specific area, without a /dev/ prefix
+func vendorDeviceName(identify []byte) string {
+	if len(identify) < nvmeVendorAreaOffset+nvmeVendorDeviceLength {
+		return ""
+	}
+	name := string(identify[nvmeVendorAreaOffset : nvmeVendorAreaOffset+nvmeVendorDeviceLength])
+	name = strings.TrimRight(name, " \x00")
+	return strings.TrimPrefix(strings.TrimSpace(name), "/dev/")
+}
+
+// Classifies the AWS NVMe disks. mapping is meta-data/block-device-mapping, key -> device name.
+// identify may be nil or fail (it needs root), the mapping is then left empty
+func classifyVolumes(disks []cloudprovider.BlockDevice, mapping map[string]string, identify NVMeIdentifyFunc) []*Volume {
+	mappingKeys := map[string]string{}
+	for key, name := range mapping {
+		if key == "ami" {
+			continue // the root device as defined in the AMI, "root" names the same device
+		}
+		mappingKeys[strings.TrimPrefix(name, "/dev/")] = key
+	}
+
+	volumes := []*Volume{}
+	for _, disk := range disks {
+		if !disk.IsNVMe() {
+			continue
+		}
+		volume := &Volume{Device: disk.Name}
+		switch disk.Model {
+		case ebsModel:
+			volume.Type = VolumeType_EBS
+			volume.VolumeID = volumeIDFromSerial(disk.Serial)
+		case instanceStoreModel:
+			volume.Type = VolumeType_InstanceStore
+		default:
+			continue
+		}
+		if identify != nil {
+			if data, err := identify(disk.Path); err == nil {
+				volume.MappingName = vendorDeviceName(data)
+			}
+		}
+		if volume.MappingName != "" {
+			volume.MappingKey = mappingKeys[volume.MappingName]
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// http://169.254.169.254/latest/meta-data/block-device-mapping/ lists the keys (ami, root, ebs1, ephemeral0, ...),
+// each key returns the device name
+func (provider *AmzServiceProvider) getBlockDeviceMappingContext(ctx context.Context) (mapping map[string]string, err error) {
+	keys, err := provider.client.GetMetadataContext(ctx, "block-device-mapping/")
+	if err != nil {
+		return
+	}
+	mapping = map[string]string{}
+	for _, key := range strings.Fields(keys) {
+		name, err := provider.client.GetMetadataContext(ctx, "block-device-mapping/"+key)
+		if err == nil {
+			mapping[key] = strings.TrimSpace(name)
+		}
+	}
+	return
+}
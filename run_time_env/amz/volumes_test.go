@@ -0,0 +1,61 @@
+package amz
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+func identifyData(name string) []byte {
+	data := make([]byte, 4096)
+	copy(data[nvmeVendorAreaOffset:], name)
+	for i := nvmeVendorAreaOffset + len(name); i < nvmeVendorAreaOffset+nvmeVendorDeviceLength; i++ {
+		data[i] = ' '
+	}
+	return data
+}
+
+func TestClassifyVolumes(t *testing.T) {
+	disks := []cloudprovider.BlockDevice{
+		{Name: "nvme0n1", Path: "/dev/nvme0n1", Model: ebsModel, Serial: "vol0123456789abcdef0", NVMeNamespace: 1},
+		{Name: "nvme1n1", Path: "/dev/nvme1n1", Model: ebsModel, Serial: "vol0fedcba9876543210", NVMeNamespace: 1},
+		{Name: "nvme2n1", Path: "/dev/nvme2n1", Model: instanceStoreModel, Serial: "AWS22A6E17D6E0A2D6A4", NVMeNamespace: 1},
+		{Name: "nvme3n1", Path: "/dev/nvme3n1", Model: "Samsung SSD 980", NVMeNamespace: 1},
+		{Name: "sda", Path: "/dev/sda", Model: ebsModel, Serial: "vol0aaaaaaaaaaaaaaaa"},
+	}
+	mapping := map[string]string{"ami": "/dev/xvda", "root": "/dev/xvda", "ebs2": "sdf"}
+	identify := func(devicePath string) ([]byte, error) {
+		switch devicePath {
+		case "/dev/nvme0n1":
+			return identifyData("/dev/xvda"), nil
+		case "/dev/nvme1n1":
+			return identifyData("sdf"), nil
+		}
+		return nil, errors.New("operation not permitted")
+	}
+
+	volumes := classifyVolumes(disks, mapping, identify)
+	expected := []*Volume{
+		{Device: "nvme0n1", Type: VolumeType_EBS, VolumeID: "vol-0123456789abcdef0", MappingName: "xvda", MappingKey: "root"},
+		{Device: "nvme1n1", Type: VolumeType_EBS, VolumeID: "vol-0fedcba9876543210", MappingName: "sdf", MappingKey: "ebs2"},
+		{Device: "nvme2n1", Type: VolumeType_InstanceStore},
+	}
+	if !reflect.DeepEqual(volumes, expected) {
+		t.Errorf("got %v, want %v", volumes, expected)
+	}
+}
+
+func TestVolumeIDFromSerial(t *testing.T) {
+	tests := map[string]string{
+		"vol0123456789abcdef0":  "vol-0123456789abcdef0",
+		"vol-0123456789abcdef0": "vol-0123456789abcdef0",
+		"AWS22A6E17D6E0A2D6A4":  "",
+	}
+	for serial, expected := range tests {
+		if id := volumeIDFromSerial(serial); id != expected {
+			t.Errorf("%v: got %v, want %v", serial, id, expected)
+		}
+	}
+}
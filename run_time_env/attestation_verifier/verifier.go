@@ -0,0 +1,123 @@
+// Server side validation of the attestation bundles produced by cloudprovider.Attest.
+// Verification is offline, the trusted certificates and keys are configured in Options
+package attestation_verifier
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/amz"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/azure"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/gcp"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/on_prem"
+)
+
+// What is trusted, bundles of a provider without configuration are rejected
+type Options struct {
+	AWS *amz.IdentityVerifier
+	// AWS bundles are not bound to the nonce and can be replayed by anyone who has seen one,
+	// they are rejected unless this is set
+	AllowUnboundAWS bool
+	// Roots nil means the system roots
+	Azure *azure.AttestationOptions
+	// Google's token keys by key id, see gcp.ParseGoogleCertificates
+	GCPKeys map[string]*rsa.PublicKey
+	// The key enrolled for an on premises instance, nil if there is none
+	LocalKeys func(instanceID string) crypto.PublicKey
+	// The verification time, time.Now if nil
+	Now func() time.Time
+}
+
+// A verified machine identity
+type Identity struct {
+	Provider   cloudprovider.CloudProviderType
+	InstanceID string
+	// False for AWS, the identity document holds no nonce and may have been replayed, see Options.AllowUnboundAWS
+	NonceBound bool
+	// The verified document: *amz.VerifiedIdentityDocument, *azure.AttestedDocument,
+	// *gcp.IdentityClaims or *on_prem.LocalAttestationDocument
+	Document interface{}
+}
+
+type Verifier struct {
+	opts Options
+}
+
+var formatProviders = map[cloudprovider.AttestationFormat][]cloudprovider.CloudProviderType{
+	cloudprovider.AttestationFormat_AWSIdentityDocument:   {cloudprovider.CloudProvider_Aws},
+	cloudprovider.AttestationFormat_AzureAttestedDocument: {cloudprovider.CloudProvider_Azure},
+	cloudprovider.AttestationFormat_GCPIdentityToken:      {cloudprovider.CloudProvider_Gcp},
+	cloudprovider.AttestationFormat_LocalKey:              {cloudprovider.CloudProvider_OnPremConfig},
+}
+
+func New(opts Options) *Verifier {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Verifier{opts: opts}
+}
+
+// Verifies a JSON encoded bundle
+func (verifier *Verifier) VerifyJSON(data []byte, nonce string) (*Identity, error) {
+	bundle, err := cloudprovider.ParseAttestationBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	return verifier.Verify(bundle, nonce)
+}
+
+// Verifies that bundle answers nonce and returns the identity it proves
+func (verifier *Verifier) Verify(bundle *cloudprovider.AttestationBundle, nonce string) (*Identity, error) {
+	if nonce == "" || bundle.Nonce != nonce {
+		return nil, fmt.Errorf("%w: bundle nonce %q, expected %q", cloudprovider.ErrAttestationMismatch, bundle.Nonce, nonce)
+	}
+	if !isFormatOf(bundle.Format, bundle.Provider) {
+		return nil, fmt.Errorf("%w: %v bundle of %v", cloudprovider.ErrInvalidConfig, bundle.Format, bundle.Provider)
+	}
+
+	identity := &Identity{Provider: bundle.Provider, InstanceID: bundle.InstanceID, NonceBound: true}
+	var err error
+	switch bundle.Format {
+	case cloudprovider.AttestationFormat_AWSIdentityDocument:
+		if !verifier.opts.AllowUnboundAWS {
+			return nil, fmt.Errorf("%w: AWS identity documents are not bound to the nonce and AllowUnboundAWS is not set",
+				cloudprovider.ErrAttestationMismatch)
+		}
+		if verifier.opts.AWS == nil {
+			return nil, fmt.Errorf("%w: no AWS certificates configured", cloudprovider.ErrUntrustedCertificate)
+		}
+		identity.NonceBound = false
+		identity.Document, err = amz.VerifyAttestationBundle(bundle, verifier.opts.AWS)
+	case cloudprovider.AttestationFormat_AzureAttestedDocument:
+		if verifier.opts.Azure == nil {
+			return nil, fmt.Errorf("%w: Azure attestation is not configured", cloudprovider.ErrUntrustedCertificate)
+		}
+		opts := *verifier.opts.Azure
+		opts.Now = verifier.opts.Now()
+		identity.Document, err = azure.VerifyAttestationBundle(bundle, opts)
+	case cloudprovider.AttestationFormat_GCPIdentityToken:
+		identity.Document, err = gcp.VerifyAttestationBundle(bundle, verifier.opts.GCPKeys, verifier.opts.Now())
+	case cloudprovider.AttestationFormat_LocalKey:
+		var key crypto.PublicKey
+		if verifier.opts.LocalKeys != nil {
+			key = verifier.opts.LocalKeys(bundle.InstanceID)
+		}
+		identity.Document, err = on_prem.VerifyAttestationBundle(bundle, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func isFormatOf(format cloudprovider.AttestationFormat, provider cloudprovider.CloudProviderType) bool {
+	for _, p := range formatProviders[format] {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package attestation_verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/amz"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/on_prem"
+)
+
+// An on premises machine configured with key, returns its provider
+func newOnPremMachine(t *testing.T, key crypto.Signer) cloudprovider.ICloudProviderVirtualMachine {
+	dir := t.TempDir()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "attestation.key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"machine_info": {"instance_id": "vlz-node-1", "zone": "z1", "region": "r1"}, "attestation_key_file": "attestation.key"}`
+	if err = os.WriteFile(filepath.Join(dir, "machine_info.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	provider := on_prem.NewOnPremConfigServiceProvider(filepath.Join(dir, "machine_info.json"))
+	if err = provider.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestVerifyLocalKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecdsaKey, "ed25519": ed25519Key} {
+		t.Run(name, func(t *testing.T) {
+			provider := newOnPremMachine(t, key)
+			bundle, err := cloudprovider.Attest(context.Background(), provider, "enroll-42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// as sent to the server
+			data, err := json.Marshal(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			enrolled := map[string]crypto.PublicKey{"vlz-node-1": key.Public()}
+			verifier := New(Options{LocalKeys: func(instanceID string) crypto.PublicKey { return enrolled[instanceID] }})
+			identity, err := verifier.VerifyJSON(data, "enroll-42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			document, _ := identity.Document.(*on_prem.LocalAttestationDocument)
+			if identity.Provider != cloudprovider.CloudProvider_OnPremConfig || identity.InstanceID != "vlz-node-1" ||
+				!identity.NonceBound || document == nil || document.Zone != "z1" {
+				t.Errorf("identity = %+v", identity)
+			}
+
+			if _, err = verifier.VerifyJSON(data, "enroll-43"); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+				t.Errorf("other nonce: %v", err)
+			}
+			enrolled["vlz-node-1"] = rsaKey.Public()
+			if name != "rsa" {
+				if _, err = verifier.VerifyJSON(data, "enroll-42"); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+					t.Errorf("other key: %v", err)
+				}
+			}
+			delete(enrolled, "vlz-node-1")
+			if _, err = verifier.VerifyJSON(data, "enroll-42"); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+				t.Errorf("not enrolled: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedLocalKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	bundle, err := cloudprovider.Attest(context.Background(), newOnPremMachine(t, key), "enroll-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := New(Options{LocalKeys: func(string) crypto.PublicKey { return key.Public() }})
+
+	// the document is bound to the instance it was signed for
+	other := *bundle
+	other.InstanceID = "vlz-node-2"
+	if _, err = verifier.Verify(&other, "enroll-42"); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("other instance: %v", err)
+	}
+	other = *bundle
+	other.Document = append([]byte{}, bundle.Document...)
+	other.Document[len(other.Document)-2] ^= 1
+	if _, err = verifier.Verify(&other, "enroll-42"); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("modified document: %v", err)
+	}
+}
+
+func TestVerifyUnboundAWS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificates := amz.NewIdentityVerifier()
+	if err = certificates.AddCertificatePEM("", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := cloudprovider.NewAttestationBundle(cloudprovider.CloudProvider_Aws, cloudprovider.AttestationFormat_AWSIdentityDocument, "n", "i-1")
+	bundle.Document = []byte(`{"instanceId": "i-1", "region": "eu-west-1"}`)
+	digest := sha256.Sum256(bundle.Document)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	if _, err = New(Options{AWS: certificates}).Verify(bundle, "n"); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("AWS bundle without AllowUnboundAWS: %v", err)
+	}
+	identity, err := New(Options{AWS: certificates, AllowUnboundAWS: true}).Verify(bundle, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.InstanceID != "i-1" || identity.NonceBound {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestVerifyUnconfigured(t *testing.T) {
+	verifier := New(Options{AllowUnboundAWS: true})
+	for _, bundle := range []*cloudprovider.AttestationBundle{
+		cloudprovider.NewAttestationBundle(cloudprovider.CloudProvider_Aws, cloudprovider.AttestationFormat_AWSIdentityDocument, "n", "i-1"),
+		cloudprovider.NewAttestationBundle(cloudprovider.CloudProvider_Azure, cloudprovider.AttestationFormat_AzureAttestedDocument, "n", "vm"),
+		cloudprovider.NewAttestationBundle(cloudprovider.CloudProvider_Gcp, cloudprovider.AttestationFormat_GCPIdentityToken, "n", "1"),
+	} {
+		if _, err := verifier.Verify(bundle, "n"); err == nil {
+			t.Errorf("%v bundle verified without configuration", bundle.Format)
+		}
+	}
+
+	for _, name := range []cloudprovider.CloudProviderType{cloudprovider.CloudProvider_Aws, cloudprovider.CloudProvider_OnPremEnv} {
+		mismatched := cloudprovider.NewAttestationBundle(name, cloudprovider.AttestationFormat_LocalKey, "n", "i-1")
+		if _, err := verifier.Verify(mismatched, "n"); !errors.Is(err, cloudprovider.ErrInvalidConfig) {
+			t.Errorf("format of another provider (%v): %v", name, err)
+		}
+	}
+	if _, err := verifier.VerifyJSON([]byte(`{"version": 9}`), "n"); !errors.Is(err, cloudprovider.ErrInvalidConfig) {
+		t.Errorf("unknown version: %v", err)
+	}
+	if _, err := cloudprovider.Attest(context.Background(), on_prem.NewOnPremEnvServiceProvider(), "n"); !errors.Is(err, cloudprovider.ErrUnimplemented) {
+		t.Errorf("environment provider: %v", err)
+	}
+}
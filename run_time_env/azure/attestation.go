@@ -0,0 +1,243 @@
+package azure
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util/pkcs7"
+)
+
+const (
+	// The attested document is signed by a certificate issued to this name
+	AttestationDNSName = "metadata.azure.com"
+
+	attestationTimeLayout = "01/02/06 15:04:05 -0700"
+	maxNonceLength        = 10
+	attestationClockSkew  = 5 * time.Minute
+)
+
+// The signed content of the attested document
+// https://learn.microsoft.com/en-us/azure/virtual-machines/instance-metadata-service#attested-data
+type AttestedData struct {
+	Nonce string `json:"nonce"`
+	Plan  struct {
+		Name      string `json:"name"`
+		Product   string `json:"product"`
+		Publisher string `json:"publisher"`
+	} `json:"plan"`
+	TimeStamp struct {
+		CreatedOn string `json:"createdOn"` // attestationTimeLayout
+		ExpiresOn string `json:"expiresOn"`
+	} `json:"timeStamp"`
+	VmID           string `json:"vmId"`
+	LicenseType    string `json:"licenseType"`
+	SubscriptionID string `json:"subscriptionId"`
+	Sku            string `json:"sku"`
+}
+
+// A verified attested document
+type AttestedDocument struct {
+	AttestedData
+	CreatedOn time.Time
+	ExpiresOn time.Time
+	Signature string            // the base64 PKCS #7 message as returned, can be verified again with VerifyAttestedDocument
+	Signer    *x509.Certificate // the certificate that signed the document
+}
+
+type AttestationOptions struct {
+	// The roots the signing certificate must chain to, the system roots if nil
+	Roots *x509.CertPool
+	// Intermediates that are not embedded in the document. Azure does not always embed the
+	// issuing CA, it has to be downloaded from the certificate's AIA URL
+	Intermediates *x509.CertPool
+	// The name the signing certificate is issued to, AttestationDNSName if empty
+	DNSName string
+	// The time the document and certificates are checked at, time.Now() if zero
+	Now time.Time
+}
+
+type attestedResponse struct {
+	Encoding  string `json:"encoding"`
+	Signature string `json:"signature"`
+}
+
+// Requests an attested document for nonce, verifies it and checks that it describes this VM.
+// Azure accepts nonces of up to 10 digits
+func (provider *AzureServiceProvider) Attest(nonce string, opts AttestationOptions) (*AttestedDocument, error) {
+	return provider.AttestContext(context.Background(), nonce, opts)
+}
+
+func (provider *AzureServiceProvider) AttestContext(ctx context.Context, nonce string, opts AttestationOptions) (*AttestedDocument, error) {
+	if provider.info == nil {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	if err := validateNonce(nonce); err != nil {
+		return nil, err
+	}
+
+	signature, err := provider.getAttestedDocument(ctx, nonce)
+	if err != nil {
+		return nil, err
+	}
+	document, err := VerifyAttestedDocument(signature, nonce, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = document.checkDetails(GetDetails(provider.info)); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// Returns the base64 PKCS #7 attested document
+func (provider *AzureServiceProvider) getAttestedDocument(ctx context.Context, nonce string) (string, error) {
+	data, err := provider.getMetadata(ctx, formatURL(provider.getBaseURL(), "attested/document")+"&nonce="+url.QueryEscape(nonce))
+	if err != nil {
+		return "", err
+	}
+	var response attestedResponse
+	if err = json.Unmarshal([]byte(data), &response); err != nil {
+		return "", fmt.Errorf("invalid attested document: %w", err)
+	}
+	if response.Encoding != "pkcs7" {
+		return "", fmt.Errorf("%w: unsupported attested document encoding %q", cloudprovider.ErrInvalidSignature, response.Encoding)
+	}
+	return response.Signature, nil
+}
+
+// Verifies the signature of an attested document offline: the certificate chain, the nonce and
+// the validity period. The caller checks that the VM and subscription are the expected ones
+func VerifyAttestedDocument(signature string, nonce string, opts AttestationOptions) (*AttestedDocument, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signature), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: attested document is not base64: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	message, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attested document: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	dnsName := opts.DNSName
+	if dnsName == "" {
+		dnsName = AttestationDNSName
+	}
+	verifyOptions := x509.VerifyOptions{
+		Roots:       opts.Roots,
+		DNSName:     dnsName,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if opts.Intermediates != nil {
+		verifyOptions.Intermediates = opts.Intermediates.Clone()
+	}
+	signers, err := message.VerifyChain(verifyOptions)
+	if err != nil {
+		return nil, fmt.Errorf("attested document: %w", err)
+	}
+
+	document := &AttestedDocument{Signature: signature, Signer: signers[0]}
+	if err = json.Unmarshal(message.Content, &document.AttestedData); err != nil {
+		return nil, fmt.Errorf("%w: invalid attested data: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	if document.CreatedOn, err = time.Parse(attestationTimeLayout, document.TimeStamp.CreatedOn); err != nil {
+		return nil, fmt.Errorf("%w: invalid attested data creation time: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	if document.ExpiresOn, err = time.Parse(attestationTimeLayout, document.TimeStamp.ExpiresOn); err != nil {
+		return nil, fmt.Errorf("%w: invalid attested data expiration time: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+
+	if document.Nonce != nonce {
+		return nil, fmt.Errorf("%w: attested nonce %q, expected %q", cloudprovider.ErrAttestationMismatch, document.Nonce, nonce)
+	}
+	if now.Before(document.CreatedOn.Add(-attestationClockSkew)) || now.After(document.ExpiresOn) {
+		return nil, fmt.Errorf("%w: attested document is valid from %v to %v", cloudprovider.ErrAttestationMismatch,
+			document.CreatedOn.Format(time.RFC3339), document.ExpiresOn.Format(time.RFC3339))
+	}
+	return document, nil
+}
+
+var _ cloudprovider.IAttester = (*AzureServiceProvider)(nil)
+
+// The attested document nonce for a bundle nonce. Azure only accepts up to 10 digits,
+// other nonces are mapped to 10 digits of their SHA-256
+func AttestationNonce(nonce string) string {
+	if validateNonce(nonce) == nil {
+		return nonce
+	}
+	digest := sha256.Sum256([]byte(nonce))
+	return fmt.Sprintf("%010d", binary.BigEndian.Uint64(digest[:8])%10000000000)
+}
+
+// Returns the attested document for AttestationNonce(nonce), verify it with VerifyAttestationBundle
+func (provider *AzureServiceProvider) AttestIdentity(ctx context.Context, nonce string) (*cloudprovider.AttestationBundle, error) {
+	if provider.info == nil {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	signature, err := provider.getAttestedDocument(ctx, AttestationNonce(nonce))
+	if err != nil {
+		return nil, err
+	}
+	bundle := cloudprovider.NewAttestationBundle(provider.GetName(), cloudprovider.AttestationFormat_AzureAttestedDocument, nonce, GetDetails(provider.info).VmID)
+	bundle.Signature = signature
+	return bundle, nil
+}
+
+// Verifies an Azure bundle: the attested document signature, its nonce and that it names the bundle's VM
+func VerifyAttestationBundle(bundle *cloudprovider.AttestationBundle, opts AttestationOptions) (*AttestedDocument, error) {
+	if bundle.Format != cloudprovider.AttestationFormat_AzureAttestedDocument {
+		return nil, fmt.Errorf("%w: %v bundle is not an Azure attested document", cloudprovider.ErrInvalidConfig, bundle.Format)
+	}
+	document, err := VerifyAttestedDocument(bundle.Signature, AttestationNonce(bundle.Nonce), opts)
+	if err != nil {
+		return nil, err
+	}
+	if document.VmID != bundle.InstanceID {
+		return nil, fmt.Errorf("%w: bundle of %v holds the attested document of %v", cloudprovider.ErrAttestationMismatch,
+			bundle.InstanceID, document.VmID)
+	}
+	return document, nil
+}
+
+// Compares the attested identity with the instance metadata
+func (document *AttestedDocument) checkDetails(details *AdditionalInfo) error {
+	for _, field := range []struct{ name, attested, expected string }{
+		{"vmId", document.VmID, details.VmID},
+		{"subscriptionId", document.SubscriptionID, details.AccountID},
+		{"sku", document.Sku, details.ImageID},
+	} {
+		if field.attested != field.expected {
+			return fmt.Errorf("%w: attested %v %q, instance metadata has %q", cloudprovider.ErrAttestationMismatch,
+				field.name, field.attested, field.expected)
+		}
+	}
+	return nil
+}
+
+func validateNonce(nonce string) error {
+	if nonce == "" {
+		// Azure would attest the current time instead
+		return fmt.Errorf("%w: empty attestation nonce", cloudprovider.ErrInvalidConfig)
+	}
+	if len(nonce) > maxNonceLength {
+		return fmt.Errorf("%w: attestation nonce longer than %v digits", cloudprovider.ErrInvalidConfig, maxNonceLength)
+	}
+	for _, c := range nonce {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("%w: attestation nonce %q is not numeric", cloudprovider.ErrInvalidConfig, nonce)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util/pkcs7"
+)
+
+// A CA and a certificate for metadata.azure.com signed by it
+type attestationCA struct {
+	t              *testing.T
+	roots          *x509.CertPool
+	signer         *x509.Certificate
+	signerKey      *rsa.PrivateKey
+	createdOn      time.Time
+	expiresOn      time.Time
+	vmID           string
+	subscriptionID string
+	requests       int
+}
+
+func newAttestationCA(t *testing.T) *attestationCA {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	signerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signerTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: AttestationDNSName},
+		DNSNames:     []string{AttestationDNSName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	signerDER, err := x509.CreateCertificate(rand.Reader, signerTemplate, ca, &signerKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _ := x509.ParseCertificate(signerDER)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	now := time.Now().UTC().Truncate(time.Second)
+	return &attestationCA{
+		t:              t,
+		roots:          roots,
+		signer:         signer,
+		signerKey:      signerKey,
+		createdOn:      now,
+		expiresOn:      now.Add(6 * time.Hour),
+		vmID:           "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+		subscriptionID: "8d10da13-8125-4ba9-a717-bf7490507b3d",
+	}
+}
+
+func (ca *attestationCA) sign(nonce string) string {
+	content := fmt.Sprintf(`{"nonce":"%v","plan":{"name":"","product":"","publisher":""},`+
+		`"timeStamp":{"createdOn":"%v","expiresOn":"%v"},"vmId":"%v","licenseType":"","subscriptionId":"%v","sku":"22_04-lts-gen2"}`,
+		nonce, ca.createdOn.Format(attestationTimeLayout), ca.expiresOn.Format(attestationTimeLayout), ca.vmID, ca.subscriptionID)
+	signature, err := pkcs7.Sign([]byte(content), ca.signer, ca.signerKey)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func (ca *attestationCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Metadata") != "True" || r.URL.Path != "/metadata/attested/document" || r.URL.Query().Get("api-version") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ca.requests++
+	fmt.Fprintf(w, `{"encoding":"pkcs7","signature":"%v"}`, ca.sign(r.URL.Query().Get("nonce")))
+}
+
+func newAttestationProvider(baseURL string, vmID string) *AzureServiceProvider {
+	details := &AdditionalInfo{VmID: vmID, AccountID: "8d10da13-8125-4ba9-a717-bf7490507b3d", ImageID: "22_04-lts-gen2"}
+	return &AzureServiceProvider{
+		baseURL: baseURL,
+		info:    &cloudprovider.MachineInfo{Provider: cloudprovider.CloudProvider_Azure, Details: details},
+	}
+}
+
+func TestAttest(t *testing.T) {
+	ca := newAttestationCA(t)
+	server := httptest.NewServer(ca)
+	defer server.Close()
+	opts := AttestationOptions{Roots: ca.roots}
+
+	provider := newAttestationProvider(server.URL+"/metadata", ca.vmID)
+	document, err := provider.Attest("1234567890", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if document.Nonce != "1234567890" || document.VmID != ca.vmID || document.Sku != "22_04-lts-gen2" ||
+		!document.CreatedOn.Equal(ca.createdOn) || !document.ExpiresOn.Equal(ca.expiresOn) ||
+		!document.Signer.Equal(ca.signer) {
+		t.Errorf("document = %+v", document)
+	}
+
+	// the server side verifies the same signature offline
+	if _, err = VerifyAttestedDocument(document.Signature, "1234567890", opts); err != nil {
+		t.Error(err)
+	}
+
+	other := newAttestationProvider(server.URL+"/metadata", "c3b3c6d1-8f5c-4d8b-9c53-1d5b26d2c4b0")
+	if _, err = other.Attest("1234567890", opts); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("other VM: %v", err)
+	}
+
+	for _, nonce := range []string{"", "12345678901", "12ab"} {
+		if _, err = provider.Attest(nonce, opts); !errors.Is(err, cloudprovider.ErrInvalidConfig) {
+			t.Errorf("nonce %q: %v", nonce, err)
+		}
+	}
+	if ca.requests != 2 {
+		t.Errorf("%v documents requested", ca.requests)
+	}
+
+	if _, err = (&AzureServiceProvider{}).Attest("1", opts); !errors.Is(err, cloudprovider.ErrNotDetected) {
+		t.Errorf("not initialized: %v", err)
+	}
+}
+
+func TestVerifyAttestedDocument(t *testing.T) {
+	ca := newAttestationCA(t)
+	signature := ca.sign("42")
+	opts := AttestationOptions{Roots: ca.roots}
+
+	if _, err := VerifyAttestedDocument(signature, "42", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAttestedDocument(signature, "43", opts); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("replayed nonce: %v", err)
+	}
+	expired := opts
+	expired.Now = ca.expiresOn.Add(time.Minute)
+	if _, err := VerifyAttestedDocument(signature, "42", expired); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("expired: %v", err)
+	}
+	if _, err := VerifyAttestedDocument(signature, "42", AttestationOptions{Roots: x509.NewCertPool()}); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+		t.Errorf("untrusted root: %v", err)
+	}
+	otherName := opts
+	otherName.DNSName = "metadata.example.com"
+	if _, err := VerifyAttestedDocument(signature, "42", otherName); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+		t.Errorf("other name: %v", err)
+	}
+
+	der, _ := base64.StdEncoding.DecodeString(signature)
+	der[len(der)-1] ^= 1
+	if _, err := VerifyAttestedDocument(base64.StdEncoding.EncodeToString(der), "42", opts); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("modified signature: %v", err)
+	}
+	if _, err := VerifyAttestedDocument("not base64!", "42", opts); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("not base64: %v", err)
+	}
+}
+
+func TestAttestIdentity(t *testing.T) {
+	ca := newAttestationCA(t)
+	server := httptest.NewServer(ca)
+	defer server.Close()
+	provider := newAttestationProvider(server.URL+"/metadata", ca.vmID)
+
+	// nonces Azure does not accept are mapped to 10 digits
+	for _, nonce := range []string{"1234567890", "enroll-7a4f0c"} {
+		bundle, err := cloudprovider.Attest(context.Background(), provider, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bundle.Format != cloudprovider.AttestationFormat_AzureAttestedDocument || bundle.InstanceID != ca.vmID || bundle.Nonce != nonce {
+			t.Errorf("bundle = %+v", bundle)
+		}
+		document, err := VerifyAttestationBundle(bundle, AttestationOptions{Roots: ca.roots})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if document.Nonce != AttestationNonce(nonce) || len(document.Nonce) != 10 {
+			t.Errorf("attested nonce %q for %q", document.Nonce, nonce)
+		}
+
+		bundle.Nonce += "0"
+		if _, err = VerifyAttestationBundle(bundle, AttestationOptions{Roots: ca.roots}); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+			t.Errorf("other nonce: %v", err)
+		}
+	}
+}
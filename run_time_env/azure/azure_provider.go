@@ -1,46 +1,86 @@
 package azure
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
 )
 
+const (
+	metadataPath = "/metadata"
+	apiVersion   = "2021-02-01"
+)
+
+// Azure details of MachineInfo, see GetDetails
 type AdditionalInfo struct {
-	InstanceType   string // Compute.InstanceType  (vmSize)
-	GroupName      string // Compute.ResourceGroupName (resourceGroupName)
-	ImageID        string // Compute.Sku
-	OsType         string // Compute.OsType (osType)
-	VmID           string // Compute.VMID
-	AccountID      string // Compute.SubscriptionId (subscriptionId)
-	VmScaleSetName string
+	InstanceType   string  `json:"instance_type" yaml:"instance_type"` // Compute.InstanceType  (vmSize)
+	GroupName      string  `json:"group_name" yaml:"group_name"`       // Compute.ResourceGroupName (resourceGroupName)
+	ImageID        string  `json:"image_id" yaml:"image_id"`           // Compute.Sku
+	OsType         string  `json:"os_type" yaml:"os_type"`             // Compute.OsType (osType)
+	VmID           string  `json:"vm_id" yaml:"vm_id"`                 // Compute.VMID
+	VmName         string  `json:"vm_name" yaml:"vm_name"`             // Compute.Name, as listed in the Resources of scheduled events
+	AccountID      string  `json:"account_id" yaml:"account_id"`       // Compute.SubscriptionId (subscriptionId)
+	VmScaleSetName string  `json:"vm_scale_set_name" yaml:"vm_scale_set_name"`
+	Disks          []*Disk `json:"disks" yaml:"disks"`
+}
+
+func init() {
+	cloudprovider.RegisterDetails(cloudprovider.CloudProvider_Azure, func() cloudprovider.ProviderDetails { return &AdditionalInfo{} })
+}
+
+// Returns the Azure details of info, nil if info was not produced by the Azure provider
+func GetDetails(info *cloudprovider.MachineInfo) *AdditionalInfo {
+	details, _ := info.Details.(*AdditionalInfo)
+	return details
 }
 
 func (info *AdditionalInfo) ToArr() []cloudprovider.AdditionalParam {
 	return []cloudprovider.AdditionalParam{
-		{"VmID", info.VmID},
-		{"InstanceType", info.InstanceType},
-		{"GroupName", info.GroupName},
-		{"ImageID", info.ImageID},
-		{"OS Type", info.OsType},
-		{"AccountID", info.AccountID},
-		{"VmScaleSetName", info.VmScaleSetName},
+		{Key: "VmID", Value: info.VmID},
+		{Key: "VmName", Value: info.VmName},
+		{Key: "InstanceType", Value: info.InstanceType},
+		{Key: "GroupName", Value: info.GroupName},
+		{Key: "ImageID", Value: info.ImageID},
+		{Key: "OS Type", Value: info.OsType},
+		{Key: "AccountID", Value: info.AccountID},
+		{Key: "VmScaleSetName", Value: info.VmScaleSetName},
+		{Key: "Disks", Value: fmt.Sprintf("%v", info.Disks)},
 	}
 }
 
 type AzureServiceProvider struct {
-	info *cloudprovider.MachineInfo
+	info               *cloudprovider.MachineInfo
+	baseURL            string
+	scheduledEventsURL string
+	retry              *util.RetryPolicy
 }
 
-var _ cloudprovider.ICloudProviderVirtualMachine = (*AzureServiceProvider)(nil)
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*AzureServiceProvider)(nil)
 
 func NewAzureServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
-	return &AzureServiceProvider{}
+	return NewAzureServiceProviderWithEndpoint("")
+}
+
+// endpoint is the scheme and host of IMDS, e.g. http://127.0.0.1:8080, util.AzureMetadataEndpoint() if empty
+func NewAzureServiceProviderWithEndpoint(endpoint string) cloudprovider.ICloudProviderVirtualMachine {
+	return NewAzureServiceProviderWithOptions(util.MetadataClientOptions{Endpoint: endpoint})
+}
+
+// opts.Retry is also used for the scheduled events
+func NewAzureServiceProviderWithOptions(opts util.MetadataClientOptions) cloudprovider.ICloudProviderVirtualMachine {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = util.AzureMetadataEndpoint()
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	return &AzureServiceProvider{baseURL: endpoint + metadataPath, scheduledEventsURL: endpoint + scheduledEventsPath, retry: opts.Retry}
 }
 
 func (provider *AzureServiceProvider) GetName() cloudprovider.CloudProviderType {
@@ -48,17 +88,21 @@ func (provider *AzureServiceProvider) GetName() cloudprovider.CloudProviderType
 }
 
 func (provider *AzureServiceProvider) Init() error {
+	return provider.InitContext(context.Background())
+}
+
+func (provider *AzureServiceProvider) InitContext(ctx context.Context) error {
 	var jsonData []byte
-	if _, err := getMetadata(formatURL("attested/document")); err != nil {
+	if _, err := provider.getMetadata(ctx, formatURL(provider.getBaseURL(), "attested/document")); err != nil {
 		// Try local config
 		var readErr error
 		jsonData, readErr = os.ReadFile("azure_instance.json")
 		if readErr != nil {
-			return errors.New(fmt.Sprintf(`failed to retrieve azure metadata (%v), failed to read local config (%v)`, err, readErr))
+			return fmt.Errorf(`failed to retrieve azure metadata (%w), failed to read local config (%v)`, err, readErr)
 		}
 	}
 
-	s, err := getMetadata(formatURL("instance"))
+	s, err := provider.getMetadata(ctx, formatURL(provider.getBaseURL(), "instance"))
 	if err != nil {
 		return err
 	}
@@ -66,8 +110,9 @@ func (provider *AzureServiceProvider) Init() error {
 
 	var data AzureMetaData
 	if err = json.Unmarshal(jsonData, &data); err != nil {
-		return err
+		return fmt.Errorf("%w: invalid instance metadata: %v", util.ErrNotDetected, err)
 	}
+	devices := cloudprovider.GetBlockDevices()
 
 	additionalInfo := &AdditionalInfo{
 		InstanceType:   data.Compute.InstanceType,
@@ -75,8 +120,10 @@ func (provider *AzureServiceProvider) Init() error {
 		ImageID:        data.Compute.Sku,
 		OsType:         data.Compute.OsType,
 		VmID:           data.Compute.VMID,
+		VmName:         data.Compute.Name,
 		AccountID:      data.Compute.SubscriptionId,
 		VmScaleSetName: data.Compute.VmScaleSetName,
+		Disks:          mapDisks(devices, &data.Compute.StorageProfile, DefaultDiskLinksRoot, cloudprovider.SysfsRoot()),
 	}
 	instanceID := data.Compute.OSProfile.ComputerName
 	if instanceID == "" {
@@ -89,20 +136,27 @@ func (provider *AzureServiceProvider) Init() error {
 		zone = fmt.Sprintf(`%v-%v`, data.Compute.Location, data.Compute.Zone) //zone seems to be just number in azure creating concatenation of region+zone to get virtual zone
 	}
 	provider.info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
 		InstanceID:   instanceID,
 		Zone:         zone,
 		Region:       data.Compute.Location,
 		Architecture: "",
 		IPAddresses:  data.Network.GetPrivateIPs(),
 		PublicDNS:    data.Network.GetPublicDNS(),
+		Disks:        devices,
 		Additional:   additionalInfo.ToArr(),
+		Details:      additionalInfo,
 	}
 	return nil
 }
 
 func (provider *AzureServiceProvider) GetMachineInfo() (*cloudprovider.MachineInfo, error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *AzureServiceProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
 	if provider.info == nil {
-		return nil, errors.New("Failed to retrieve")
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
 	}
 	return provider.info, nil
 }
@@ -111,23 +165,47 @@ func (provider *AzureServiceProvider) GetVirtualMachineID() (instanceId string,
 	return cloudprovider.GetVirtualMachineID(provider)
 }
 
-func formatURL(relativePath string) string {
-	return fmt.Sprintf(`http://169.254.169.254/metadata/%v?api-version=2021-02-01`, relativePath)
+func (provider *AzureServiceProvider) getBaseURL() string {
+	if provider.baseURL == "" {
+		return util.AzureMetadataEndpoint() + metadataPath
+	}
+	return provider.baseURL
+}
+
+func formatURL(baseURL string, relativePath string) string {
+	return fmt.Sprintf(`%v/%v?api-version=%v`, baseURL, relativePath, apiVersion)
+}
+
+// IMDS answers 429 above 5 requests per second, those and other transient failures are retried
+// as the provider's retry policy says
+func (provider *AzureServiceProvider) getMetadata(ctx context.Context, url string) (string, error) {
+	return getMetadataWithClient(ctx, util.RetryPolicyOrDefault(provider.retry), util.MetadataHTTPClient, url)
+}
+
+func getMetadataWithClient(ctx context.Context, policy util.RetryPolicy, client *http.Client, url string) (result string, err error) {
+	err = policy.Do(ctx, func() (err error) {
+		result, err = getMetadataOnce(ctx, client, url)
+		return
+	})
+	return
 }
 
-func getMetadata(url string) (string, error) {
-	request, err := http.NewRequest(http.MethodGet, url, nil)
+func getMetadataOnce(ctx context.Context, client *http.Client, url string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
 	request.Header.Add("Metadata", "True")
 	// request.Header.Add("content-type", "application/json")
 
-	response, err := http.DefaultClient.Do(request)
+	response, err := client.Do(request)
 	if err != nil {
-		return "", err
+		return "", util.NewRequestError(request, err)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
-		return "", errors.New(fmt.Sprintf(`%v`, response))
+		return "", util.NewStatusError(request, response)
 	}
 
 	body, err := io.ReadAll(response.Body)
@@ -154,17 +232,37 @@ type AzureMetaData struct {
 }
 
 type AzureMetaDataCompute struct {
-	VMID              string         `json:"vmId"`
-	Zone              string         `json:"zone"`
-	Location          string         `json:"location"` //REGION
-	Name              string         `json:"name"`
-	OSProfile         AzureOsProfile `json:"osProfile"`
-	Sku               string         `json:"sku"`
-	ResourceGroupName string         `json:"resourceGroupName"`
-	InstanceType      string         `json:"vmSize"`
-	OsType            string         `json:"osType"`
-	VmScaleSetName    string         `json:"vmScaleSetName"`
-	SubscriptionId    string         `json:"subscriptionId"`
+	VMID              string                      `json:"vmId"`
+	Zone              string                      `json:"zone"`
+	Location          string                      `json:"location"` //REGION
+	Name              string                      `json:"name"`
+	OSProfile         AzureOsProfile              `json:"osProfile"`
+	Sku               string                      `json:"sku"`
+	ResourceGroupName string                      `json:"resourceGroupName"`
+	InstanceType      string                      `json:"vmSize"`
+	OsType            string                      `json:"osType"`
+	VmScaleSetName    string                      `json:"vmScaleSetName"`
+	SubscriptionId    string                      `json:"subscriptionId"`
+	StorageProfile    AzureMetaDataStorageProfile `json:"storageProfile"`
+}
+
+// IMDS reports the numbers as strings
+type AzureMetaDataStorageProfile struct {
+	DataDisks    []AzureMetaDataDataDisk `json:"dataDisks"`
+	ResourceDisk struct {
+		Size string `json:"size"` // MB
+	} `json:"resourceDisk"`
+}
+
+type AzureMetaDataDataDisk struct {
+	Lun         string `json:"lun"`
+	Name        string `json:"name"`
+	Caching     string `json:"caching"`
+	DiskSizeGB  string `json:"diskSizeGB"`
+	ManagedDisk struct {
+		ID                 string `json:"id"`
+		StorageAccountType string `json:"storageAccountType"`
+	} `json:"managedDisk"`
 }
 
 type AzureOsProfile struct {
@@ -0,0 +1,175 @@
+package azure
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+type DiskType string
+
+const (
+	DiskType_OS        DiskType = "os"
+	DiskType_Data      DiskType = "data"
+	DiskType_Resource  DiskType = "resource"   // ephemeral temp disk, lost on deallocation
+	DiskType_LocalNVMe DiskType = "local-nvme" // ephemeral NVMe disks of storage optimized sizes (Lsv3, ...)
+
+	// Symlinks created by the Azure udev rules (waagent, azure-vm-utils)
+	DefaultDiskLinksRoot = "/dev/disk/azure"
+
+	localNVMeModel  = "Microsoft NVMe Direct Disk"
+	remoteNVMeModel = "MSFT NVMe Accelerator"
+)
+
+// A local block device of the VM, data disks are matched with storageProfile.dataDisks by LUN
+type Disk struct {
+	Device             string   `json:"device" yaml:"device"`                       // kernel name, e.g. sdc
+	Type               DiskType `json:"type" yaml:"type"`                           // os, data, resource or local-nvme
+	Lun                *int     `json:"lun,omitempty" yaml:"lun,omitempty"`         // data disks with a known LUN only
+	Name               string   `json:"name,omitempty" yaml:"name,omitempty"`       // managed disk name
+	Caching            string   `json:"caching,omitempty" yaml:"caching,omitempty"` // None, ReadOnly or ReadWrite
+	SizeGB             int      `json:"size_gb,omitempty" yaml:"size_gb,omitempty"` // provisioned size
+	ManagedDiskID      string   `json:"managed_disk_id,omitempty" yaml:"managed_disk_id,omitempty"`
+	StorageAccountType string   `json:"storage_account_type,omitempty" yaml:"storage_account_type,omitempty"` // e.g. Premium_LRS
+}
+
+func (disk *Disk) String() string {
+	if disk.Type == DiskType_Data {
+		lun := "unknown"
+		if disk.Lun != nil {
+			lun = strconv.Itoa(*disk.Lun)
+		}
+		return fmt.Sprintf(`{%v  Type: %v  LUN: %v  Name: %v  Caching: %v  SizeGB: %v}`, disk.Device, disk.Type, lun, disk.Name, disk.Caching, disk.SizeGB)
+	}
+	return fmt.Sprintf(`{%v  Type: %v}`, disk.Device, disk.Type)
+}
+
+// Correlates the local disks with the storage profile.
+// The udev symlinks under linksRoot are used when present, otherwise the SCSI address in sysfs
+func mapDisks(devices []cloudprovider.BlockDevice, profile *AzureMetaDataStorageProfile, linksRoot string, sysfsRoot string) []*Disk {
+	dataDisks := map[int]*AzureMetaDataDataDisk{}
+	for i := range profile.DataDisks {
+		if lun, err := strconv.Atoi(profile.DataDisks[i].Lun); err == nil {
+			dataDisks[lun] = &profile.DataDisks[i]
+		}
+	}
+	links := readDiskLinks(linksRoot)
+
+	disks := []*Disk{}
+	for _, device := range devices {
+		disk, ok := links[device.Name]
+		if !ok {
+			disk, ok = classifyDevice(device, sysfsRoot)
+		}
+		if !ok {
+			continue
+		}
+		disk.Device = device.Name
+		if disk.Type == DiskType_Data && disk.Lun != nil {
+			if data := dataDisks[*disk.Lun]; data != nil {
+				disk.Name = data.Name
+				disk.Caching = data.Caching
+				disk.SizeGB, _ = strconv.Atoi(data.DiskSizeGB)
+				disk.ManagedDiskID = data.ManagedDisk.ID
+				disk.StorageAccountType = data.ManagedDisk.StorageAccountType
+			}
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// Reads root, resource and scsi1/lunN, keyed by the kernel name they point at
+func readDiskLinks(linksRoot string) map[string]*Disk {
+	links := map[string]*Disk{}
+	add := func(link string, disk *Disk) {
+		target, err := os.Readlink(filepath.Join(linksRoot, link))
+		if err == nil {
+			links[filepath.Base(target)] = disk
+		}
+	}
+	add("root", &Disk{Type: DiskType_OS})
+	add("resource", &Disk{Type: DiskType_Resource})
+
+	entries, _ := os.ReadDir(filepath.Join(linksRoot, "scsi1"))
+	for _, entry := range entries {
+		lun, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "lun"))
+		if err != nil || !strings.HasPrefix(entry.Name(), "lun") {
+			continue // partitions, e.g. lun0-part1
+		}
+		add(filepath.Join("scsi1", entry.Name()), &Disk{Type: DiskType_Data, Lun: &lun})
+	}
+	return links
+}
+
+func classifyDevice(device cloudprovider.BlockDevice, sysfsRoot string) (*Disk, bool) {
+	if device.IsNVMe() {
+		switch {
+		case strings.HasPrefix(device.Model, localNVMeModel):
+			return &Disk{Type: DiskType_LocalNVMe}, true
+		case strings.HasPrefix(device.Model, remoteNVMeModel):
+			// NVMe attached managed disks: namespace 1 is the OS disk, data disk LUNs start at namespace 2
+			switch {
+			case device.NVMeNamespace == 1:
+				return &Disk{Type: DiskType_OS}, true
+			case device.NVMeNamespace < 2:
+				// not a valid namespace id, the disk cannot be placed
+				return nil, false
+			}
+			lun := device.NVMeNamespace - 2
+			return &Disk{Type: DiskType_Data, Lun: &lun}, true
+		}
+		return nil, false
+	}
+
+	controller, lun, ok := scsiAddress(filepath.Join(sysfsRoot, "block", device.Name, "device"))
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case controller == 0 && lun == 0:
+		return &Disk{Type: DiskType_OS}, true
+	case controller == 0 && lun == 1:
+		return &Disk{Type: DiskType_Resource}, true
+	case controller == 1:
+		return &Disk{Type: DiskType_Data, Lun: &lun}, true
+	}
+	return nil, false
+}
+
+// Resolves the Hyper-V SCSI controller and LUN of a sysfs device.
+// The device directory is named host:channel:target:lun, the controller number is the second
+// group of the device_id of the VMBus device above it, e.g. {00000000-0001-8899-0000-000000000000}
+func scsiAddress(devicePath string) (controller int, lun int, ok bool) {
+	path, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return
+	}
+	address := strings.Split(filepath.Base(path), ":")
+	if len(address) != 4 {
+		return
+	}
+	if lun, err = strconv.Atoi(address[3]); err != nil {
+		return
+	}
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		content, err := os.ReadFile(filepath.Join(dir, "device_id"))
+		if err != nil {
+			continue
+		}
+		groups := strings.Split(strings.Trim(strings.TrimSpace(string(content)), "{}"), "-")
+		if len(groups) < 2 {
+			return
+		}
+		value, err := strconv.ParseInt(groups[1], 16, 32)
+		if err != nil {
+			return
+		}
+		return int(value), lun, true
+	}
+	return
+}
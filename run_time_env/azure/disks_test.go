@@ -0,0 +1,123 @@
+package azure
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+const (
+	osControllerID   = "{00000000-0000-8899-0000-000000000000}"
+	dataControllerID = "{00000000-0001-8899-0000-000000000000}"
+)
+
+func symlink(t *testing.T, target string, link string) {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Creates <sysfs>/devices/<controller guid>/host<host>/.../<address> with device_id and links block/<name>/device to it
+func writeSCSIDevice(t *testing.T, sysfs string, name string, controllerID string, address string) {
+	controller := filepath.Join(sysfs, "devices", "VMBUS:00", controllerID)
+	device := filepath.Join(controller, "host", "target", address)
+	if err := os.MkdirAll(device, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(controller, "device_id"), []byte(controllerID+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, device, filepath.Join(sysfs, "block", name, "device"))
+}
+
+func testStorageProfile() *AzureMetaDataStorageProfile {
+	profile := &AzureMetaDataStorageProfile{DataDisks: []AzureMetaDataDataDisk{
+		{Lun: "0", Name: "vlz-data-0", Caching: "None", DiskSizeGB: "1024"},
+		{Lun: "3", Name: "vlz-data-3", Caching: "ReadOnly", DiskSizeGB: "512"},
+	}}
+	profile.DataDisks[0].ManagedDisk.ID = "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/disks/vlz-data-0"
+	profile.DataDisks[0].ManagedDisk.StorageAccountType = "PremiumV2_LRS"
+	return profile
+}
+
+var testDevices = []cloudprovider.BlockDevice{
+	{Name: "nvme0n1", Model: "Microsoft NVMe Direct Disk v2", NVMeNamespace: 1},
+	{Name: "sda", Model: "Virtual Disk"},
+	{Name: "sdb", Model: "Virtual Disk"},
+	{Name: "sdc", Model: "Virtual Disk"},
+	{Name: "sdd", Model: "Virtual Disk"},
+}
+
+func intPointer(n int) *int {
+	return &n
+}
+
+func expectedDisks() []*Disk {
+	return []*Disk{
+		{Device: "nvme0n1", Type: DiskType_LocalNVMe},
+		{Device: "sda", Type: DiskType_OS},
+		{Device: "sdb", Type: DiskType_Resource},
+		{Device: "sdc", Type: DiskType_Data, Lun: intPointer(0), Name: "vlz-data-0", Caching: "None", SizeGB: 1024,
+			ManagedDiskID: "/subscriptions/s/resourceGroups/rg/providers/Microsoft.Compute/disks/vlz-data-0", StorageAccountType: "PremiumV2_LRS"},
+		{Device: "sdd", Type: DiskType_Data, Lun: intPointer(3), Name: "vlz-data-3", Caching: "ReadOnly", SizeGB: 512},
+	}
+}
+
+func TestMapDisksFromLinks(t *testing.T) {
+	links := t.TempDir()
+	symlink(t, "../../sda", filepath.Join(links, "root"))
+	symlink(t, "../../sdb", filepath.Join(links, "resource"))
+	symlink(t, "../../../sdc", filepath.Join(links, "scsi1", "lun0"))
+	symlink(t, "../../../sdc1", filepath.Join(links, "scsi1", "lun0-part1"))
+	symlink(t, "../../../sdd", filepath.Join(links, "scsi1", "lun3"))
+
+	disks := mapDisks(testDevices, testStorageProfile(), links, t.TempDir())
+	if !reflect.DeepEqual(disks, expectedDisks()) {
+		t.Errorf("got %v, want %v", disks, expectedDisks())
+	}
+}
+
+func TestMapDisksFromSysfs(t *testing.T) {
+	sysfs := t.TempDir()
+	writeSCSIDevice(t, sysfs, "sda", osControllerID, "0:0:0:0")
+	writeSCSIDevice(t, sysfs, "sdb", osControllerID, "0:0:0:1")
+	writeSCSIDevice(t, sysfs, "sdc", dataControllerID, "1:0:0:0")
+	writeSCSIDevice(t, sysfs, "sdd", dataControllerID, "1:0:0:3")
+
+	disks := mapDisks(testDevices, testStorageProfile(), t.TempDir(), sysfs)
+	if !reflect.DeepEqual(disks, expectedDisks()) {
+		t.Errorf("got %v, want %v", disks, expectedDisks())
+	}
+}
+
+func TestMapRemoteNVMeDisks(t *testing.T) {
+	devices := []cloudprovider.BlockDevice{
+		{Name: "nvme0n1", Model: "MSFT NVMe Accelerator v1.0", NVMeNamespace: 1},
+		{Name: "nvme0n2", Model: "MSFT NVMe Accelerator v1.0", NVMeNamespace: 2},
+	}
+	disks := mapDisks(devices, testStorageProfile(), t.TempDir(), t.TempDir())
+	if len(disks) != 2 || disks[0].Type != DiskType_OS || disks[1].Type != DiskType_Data || disks[1].Name != "vlz-data-0" {
+		t.Errorf("got %v", disks)
+	}
+}
+
+func TestDiskLunEncoding(t *testing.T) {
+	for _, test := range []struct {
+		disk *Disk
+		want string
+	}{
+		{&Disk{Device: "sda", Type: DiskType_OS}, `{"device":"sda","type":"os"}`},
+		{&Disk{Device: "sdc", Type: DiskType_Data, Lun: intPointer(0)}, `{"device":"sdc","type":"data","lun":0}`},
+	} {
+		if data, err := json.Marshal(test.disk); err != nil || string(data) != test.want {
+			t.Errorf("json.Marshal() = %s, %v, want %s", data, err, test.want)
+		}
+	}
+}
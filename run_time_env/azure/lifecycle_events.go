@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+var (
+	_ cloudprovider.ILifecycleEventSource       = (*AzureServiceProvider)(nil)
+	_ cloudprovider.ILifecycleEventAcknowledger = (*AzureServiceProvider)(nil)
+)
+
+var scheduledEventTypes = map[ScheduledEventType]cloudprovider.LifecycleEventType{
+	ScheduledEvent_Freeze:    cloudprovider.LifecycleEvent_Freeze,
+	ScheduledEvent_Reboot:    cloudprovider.LifecycleEvent_Reboot,
+	ScheduledEvent_Redeploy:  cloudprovider.LifecycleEvent_Redeploy,
+	ScheduledEvent_Preempt:   cloudprovider.LifecycleEvent_Preemption,
+	ScheduledEvent_Terminate: cloudprovider.LifecycleEvent_Termination,
+}
+
+// Watches the scheduled events of this VM, an event is reported again once it starts.
+// Events of other VMs in the same availability set or scale set are skipped
+func (provider *AzureServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	if provider.info == nil {
+		return fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	vmName := GetDetails(provider.info).VmName
+	watcher := newScheduledEventsWatcher(provider.getScheduledEventsURL(), ScheduledEventsOptions{
+		OnEvent: func(event *ScheduledEvent) {
+			if event.Affects(vmName) {
+				handler(scheduledToLifecycleEvent(event))
+			}
+		},
+		Retry: provider.retry,
+	})
+	return watcher.Run(ctx)
+}
+
+// Approves the scheduled event, the platform may start it right away
+func (provider *AzureServiceProvider) AcknowledgeLifecycleEvent(ctx context.Context, event *cloudprovider.LifecycleEvent) error {
+	watcher := newScheduledEventsWatcher(provider.getScheduledEventsURL(), ScheduledEventsOptions{Retry: provider.retry})
+	return watcher.ApproveContext(ctx, event.ID)
+}
+
+func (provider *AzureServiceProvider) getScheduledEventsURL() string {
+	if provider.scheduledEventsURL == "" {
+		return util.AzureMetadataEndpoint() + scheduledEventsPath
+	}
+	return provider.scheduledEventsURL
+}
+
+func scheduledToLifecycleEvent(event *ScheduledEvent) *cloudprovider.LifecycleEvent {
+	eventType, ok := scheduledEventTypes[event.Type]
+	if !ok {
+		eventType = cloudprovider.LifecycleEvent_Maintenance
+	}
+	return &cloudprovider.LifecycleEvent{
+		Provider:    cloudprovider.CloudProvider_Azure,
+		Type:        eventType,
+		ID:          event.EventID,
+		NotBefore:   event.NotBefore,
+		Started:     event.Status == ScheduledEventStatus_Started,
+		Description: event.Description,
+		Source:      event,
+	}
+}
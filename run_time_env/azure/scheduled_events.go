@@ -0,0 +1,287 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+type ScheduledEventType string
+
+const (
+	ScheduledEvent_Freeze    ScheduledEventType = "Freeze"
+	ScheduledEvent_Reboot    ScheduledEventType = "Reboot"
+	ScheduledEvent_Redeploy  ScheduledEventType = "Redeploy"
+	ScheduledEvent_Preempt   ScheduledEventType = "Preempt" // spot eviction
+	ScheduledEvent_Terminate ScheduledEventType = "Terminate"
+
+	ScheduledEventStatus_Scheduled = "Scheduled"
+	ScheduledEventStatus_Started   = "Started"
+
+	scheduledEventsPath        = "/metadata/scheduledevents?api-version=2020-07-01"
+	DefaultScheduledEventsPoll = 5 * time.Second
+	scheduledEventsBufferSize  = 8
+	// The first request enables the service, Azure documents it can take up to two minutes to answer
+	scheduledEventsTimeout = 2*time.Minute + 10*time.Second
+)
+
+var scheduledEventsHTTPClient = &http.Client{Timeout: scheduledEventsTimeout}
+
+type ScheduledEvent struct {
+	EventID      string
+	Type         ScheduledEventType
+	ResourceType string   // VirtualMachine
+	Resources    []string // names of the affected VMs
+	Status       string   // Scheduled, or Started once it is approved or NotBefore passed
+	NotBefore    time.Time
+	Description  string
+	Source       string // Platform or User
+	Duration     time.Duration
+}
+
+// Reports whether the VM named vmName is among the affected resources
+func (event *ScheduledEvent) Affects(vmName string) bool {
+	for _, resource := range event.Resources {
+		if strings.EqualFold(resource, vmName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (event *ScheduledEvent) String() string {
+	return fmt.Sprintf(`{%v  Type: %v  Status: %v  NotBefore: %v  Resources: %v}`, event.EventID, event.Type, event.Status,
+		event.NotBefore.Format(time.RFC3339), event.Resources)
+}
+
+// https://learn.microsoft.com/en-us/azure/virtual-machines/linux/scheduled-events
+type scheduledEventsDocument struct {
+	DocumentIncarnation int `json:"DocumentIncarnation"`
+	Events              []struct {
+		EventID           string   `json:"EventId"`
+		EventType         string   `json:"EventType"`
+		ResourceType      string   `json:"ResourceType"`
+		Resources         []string `json:"Resources"`
+		EventStatus       string   `json:"EventStatus"`
+		NotBefore         string   `json:"NotBefore"` // RFC1123, empty once started
+		Description       string   `json:"Description"`
+		EventSource       string   `json:"EventSource"`
+		DurationInSeconds int      `json:"DurationInSeconds"` // -1 if unknown
+	} `json:"Events"`
+}
+
+type ScheduledEventsOptions struct {
+	PollInterval time.Duration // DefaultScheduledEventsPoll if zero
+	// Called for each new or changed event instead of delivering it on Events()
+	OnEvent func(event *ScheduledEvent)
+	// Scheme and host of IMDS as for NewAzureServiceProviderWithEndpoint, util.AzureMetadataEndpoint() if empty
+	Endpoint string
+	Retry    *util.RetryPolicy // util.MetadataRetryPolicy if nil
+}
+
+// Polls the scheduled events endpoint. The events are only parsed when DocumentIncarnation changes,
+// an event is delivered again when its status changes.
+// The first request enables the service for the VM, it may take up to two minutes to answer
+type ScheduledEventsWatcher struct {
+	url      string
+	interval time.Duration
+	retry    *util.RetryPolicy
+	onEvent  func(event *ScheduledEvent)
+	events   chan *ScheduledEvent
+
+	mutex       sync.Mutex
+	incarnation int
+	seen        map[string]string // EventID -> status
+}
+
+func NewScheduledEventsWatcher(opts ScheduledEventsOptions) *ScheduledEventsWatcher {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = util.AzureMetadataEndpoint()
+	}
+	return newScheduledEventsWatcher(strings.TrimRight(endpoint, "/")+scheduledEventsPath, opts)
+}
+
+func newScheduledEventsWatcher(url string, opts ScheduledEventsOptions) *ScheduledEventsWatcher {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultScheduledEventsPoll
+	}
+	return &ScheduledEventsWatcher{
+		url:         url,
+		interval:    opts.PollInterval,
+		retry:       opts.Retry,
+		onEvent:     opts.OnEvent,
+		events:      make(chan *ScheduledEvent, scheduledEventsBufferSize),
+		incarnation: -1,
+		seen:        map[string]string{},
+	}
+}
+
+// Delivers the events when no OnEvent callback is set, closed when Run returns
+func (watcher *ScheduledEventsWatcher) Events() <-chan *ScheduledEvent {
+	return watcher.events
+}
+
+// The DocumentIncarnation of the last processed document, -1 before the first one
+func (watcher *ScheduledEventsWatcher) Incarnation() int {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	return watcher.incarnation
+}
+
+// Polls until ctx is done, returns ctx.Err(). Run may be called once
+func (watcher *ScheduledEventsWatcher) Run(ctx context.Context) error {
+	defer close(watcher.events)
+
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+	for {
+		// failures are retried on the next poll
+		events, _ := watcher.poll(ctx)
+		for _, event := range events {
+			if err := watcher.deliver(ctx, event); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns the current scheduled events
+func (watcher *ScheduledEventsWatcher) GetScheduledEvents() ([]*ScheduledEvent, error) {
+	return watcher.GetScheduledEventsContext(context.Background())
+}
+
+func (watcher *ScheduledEventsWatcher) GetScheduledEventsContext(ctx context.Context) ([]*ScheduledEvent, error) {
+	doc, err := watcher.getDocument(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return doc.toEvents()
+}
+
+// Lets the platform start the event before NotBefore, e.g. once the node is drained
+func (watcher *ScheduledEventsWatcher) Approve(eventID string) error {
+	return watcher.ApproveContext(context.Background(), eventID)
+}
+
+func (watcher *ScheduledEventsWatcher) ApproveContext(ctx context.Context, eventID string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"StartRequests": []map[string]string{{"EventId": eventID}},
+	})
+	if err != nil {
+		return err
+	}
+	// approving an event twice is harmless, so a lost answer can be retried
+	return util.RetryPolicyOrDefault(watcher.retry).Do(ctx, func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, watcher.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Add("Metadata", "True")
+		request.Header.Add("Content-Type", "application/json")
+
+		response, err := util.MetadataHTTPClient.Do(request)
+		if err != nil {
+			return util.NewRequestError(request, err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != 200 {
+			return util.NewStatusError(request, response)
+		}
+		return nil
+	})
+}
+
+// Returns the new and changed events if the document incarnation changed
+func (watcher *ScheduledEventsWatcher) poll(ctx context.Context) ([]*ScheduledEvent, error) {
+	doc, err := watcher.getDocument(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if doc.DocumentIncarnation == watcher.incarnation {
+		return nil, nil
+	}
+	events, err := doc.toEvents()
+	if err != nil {
+		return nil, err
+	}
+	watcher.incarnation = doc.DocumentIncarnation
+
+	changed := []*ScheduledEvent{}
+	current := map[string]string{}
+	for _, event := range events {
+		current[event.EventID] = event.Status
+		if watcher.seen[event.EventID] != event.Status {
+			changed = append(changed, event)
+		}
+	}
+	watcher.seen = current // completed events leave the document
+	return changed, nil
+}
+
+func (watcher *ScheduledEventsWatcher) deliver(ctx context.Context, event *ScheduledEvent) error {
+	if watcher.onEvent != nil {
+		watcher.onEvent(event)
+		return nil
+	}
+	select {
+	case watcher.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (watcher *ScheduledEventsWatcher) getDocument(ctx context.Context) (*scheduledEventsDocument, error) {
+	data, err := getMetadataWithClient(ctx, util.RetryPolicyOrDefault(watcher.retry), scheduledEventsHTTPClient, watcher.url)
+	if err != nil {
+		return nil, err
+	}
+	doc := &scheduledEventsDocument{}
+	if err = json.Unmarshal([]byte(data), doc); err != nil {
+		return nil, fmt.Errorf("invalid scheduled events: %w", err)
+	}
+	return doc, nil
+}
+
+func (doc *scheduledEventsDocument) toEvents() ([]*ScheduledEvent, error) {
+	events := []*ScheduledEvent{}
+	for _, item := range doc.Events {
+		event := &ScheduledEvent{
+			EventID:      item.EventID,
+			Type:         ScheduledEventType(item.EventType),
+			ResourceType: item.ResourceType,
+			Resources:    item.Resources,
+			Status:       item.EventStatus,
+			Description:  item.Description,
+			Source:       item.EventSource,
+		}
+		if item.DurationInSeconds > 0 {
+			event.Duration = time.Duration(item.DurationInSeconds) * time.Second
+		}
+		if item.NotBefore != "" {
+			notBefore, err := time.Parse(time.RFC1123, item.NotBefore)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scheduled event %v: %w", item.EventID, err)
+			}
+			event.NotBefore = notBefore
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,174 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+// IMDS stand-in: one Reboot event which starts when approved
+type scheduledEventsServer struct {
+	mutex       sync.Mutex
+	incarnation int
+	status      string
+	approved    []string
+	firstDelay  time.Duration // the first GET answers after this, as when the service is enabled
+}
+
+func (server *scheduledEventsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Metadata") != "True" || r.URL.Query().Get("api-version") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if r.Method == http.MethodGet && server.firstDelay > 0 {
+		time.Sleep(server.firstDelay)
+		server.firstDelay = 0
+	}
+
+	if r.Method == http.MethodPost {
+		var body struct {
+			StartRequests []struct{ EventId string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.StartRequests) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		server.approved = append(server.approved, body.StartRequests[0].EventId)
+		server.status = ScheduledEventStatus_Started
+		server.incarnation++
+		return
+	}
+	notBefore := "Fri, 16 Oct 2026 18:29:47 GMT"
+	if server.status == ScheduledEventStatus_Started {
+		notBefore = ""
+	}
+	fmt.Fprintf(w, `{
+		"DocumentIncarnation": %v,
+		"Events": [{
+			"EventId": "602d9444-d2cd-49c7-8624-8643e7171297",
+			"EventType": "Reboot",
+			"ResourceType": "VirtualMachine",
+			"Resources": ["vlz-node-1"],
+			"EventStatus": "%v",
+			"NotBefore": "%v",
+			"Description": "Virtual machine is going to be restarted as requested by authorized user.",
+			"EventSource": "User",
+			"DurationInSeconds": -1
+		}]
+	}`, server.incarnation, server.status, notBefore)
+}
+
+func TestScheduledEventsWatcher(t *testing.T) {
+	imds := &scheduledEventsServer{incarnation: 1, status: ScheduledEventStatus_Scheduled}
+	server := httptest.NewServer(imds)
+	defer server.Close()
+
+	watcher := newScheduledEventsWatcher(server.URL+"/metadata/scheduledevents?api-version=2020-07-01", ScheduledEventsOptions{PollInterval: 5 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go watcher.Run(ctx)
+
+	scheduled := <-watcher.Events()
+	if scheduled.EventID != "602d9444-d2cd-49c7-8624-8643e7171297" || scheduled.Type != ScheduledEvent_Reboot ||
+		scheduled.Status != ScheduledEventStatus_Scheduled || scheduled.Duration != 0 ||
+		!scheduled.NotBefore.Equal(time.Date(2026, 10, 16, 18, 29, 47, 0, time.UTC)) {
+		t.Errorf("scheduled = %+v", scheduled)
+	}
+
+	if err := watcher.ApproveContext(ctx, scheduled.EventID); err != nil {
+		t.Fatal(err)
+	}
+	started := <-watcher.Events()
+	if started.EventID != scheduled.EventID || started.Status != ScheduledEventStatus_Started || !started.NotBefore.IsZero() {
+		t.Errorf("started = %+v", started)
+	}
+	if watcher.Incarnation() != 2 {
+		t.Errorf("Incarnation() = %v", watcher.Incarnation())
+	}
+
+	// unchanged documents are not delivered again
+	select {
+	case event := <-watcher.Events():
+		t.Errorf("unexpected event %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	imds.mutex.Lock()
+	defer imds.mutex.Unlock()
+	if len(imds.approved) != 1 || imds.approved[0] != scheduled.EventID {
+		t.Errorf("approved = %v", imds.approved)
+	}
+}
+
+func TestScheduledEventsSlowFirstAnswer(t *testing.T) {
+	imds := &scheduledEventsServer{status: ScheduledEventStatus_Scheduled, firstDelay: util.DefaultMetadataRequestTimeout + 200*time.Millisecond}
+	server := httptest.NewServer(imds)
+	defer server.Close()
+
+	watcher := NewScheduledEventsWatcher(ScheduledEventsOptions{Endpoint: server.URL})
+	events, err := watcher.GetScheduledEvents()
+	if err != nil || len(events) != 1 {
+		t.Errorf("GetScheduledEvents() = %v, %v, want the answer that enabled the service", events, err)
+	}
+}
+
+func TestWatchLifecycleEventsOfThisVM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"DocumentIncarnation": 1,
+			"Events": [{
+				"EventId": "other-vm-event",
+				"EventType": "Freeze",
+				"ResourceType": "VirtualMachine",
+				"Resources": ["vlz-node-2"],
+				"EventStatus": "Scheduled",
+				"NotBefore": "Fri, 16 Oct 2026 18:29:47 GMT"
+			}, {
+				"EventId": "this-vm-event",
+				"EventType": "Reboot",
+				"ResourceType": "VirtualMachine",
+				"Resources": ["vlz-node-2", "VLZ-NODE-1"],
+				"EventStatus": "Scheduled",
+				"NotBefore": "Fri, 16 Oct 2026 18:29:47 GMT"
+			}]
+		}`)
+	}))
+	defer server.Close()
+
+	provider := &AzureServiceProvider{
+		scheduledEventsURL: server.URL + scheduledEventsPath,
+		info:               &cloudprovider.MachineInfo{Provider: cloudprovider.CloudProvider_Azure, Details: &AdditionalInfo{VmName: "vlz-node-1"}},
+	}
+	var mutex sync.Mutex
+	var ids []string
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	provider.WatchLifecycleEvents(ctx, func(event *cloudprovider.LifecycleEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ids = append(ids, event.ID)
+	})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(ids) != 1 || ids[0] != "this-vm-event" {
+		t.Errorf("delivered events = %v, want only the event of this VM", ids)
+	}
+}
+
+func TestWatchLifecycleEventsNotInitialized(t *testing.T) {
+	err := (&AzureServiceProvider{}).WatchLifecycleEvents(context.Background(), func(*cloudprovider.LifecycleEvent) {})
+	if !errors.Is(err, cloudprovider.ErrNotDetected) {
+		t.Errorf("WatchLifecycleEvents() = %v, want ErrNotDetected", err)
+	}
+}
@@ -0,0 +1,259 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+const (
+	metadataPath       = "/computeMetadata/v1"
+	metadataFlavorKey  = "Metadata-Flavor"
+	metadataFlavorGCE  = "Google"
+	clusterNameAttrKey = "cluster-name"
+)
+
+// GCP details of MachineInfo, see GetDetails
+type AdditionalInfo struct {
+	InstanceType     string   `json:"instance_type" yaml:"instance_type"`           // instance/machineType (last path segment)
+	Name             string   `json:"name" yaml:"name"`                             // instance/name
+	Hostname         string   `json:"hostname" yaml:"hostname"`                     // instance/hostname
+	ImageID          string   `json:"image_id" yaml:"image_id"`                     // instance/image
+	CpuPlatform      string   `json:"cpu_platform" yaml:"cpu_platform"`             // instance/cpu-platform
+	ProjectID        string   `json:"project_id" yaml:"project_id"`                 // project/project-id
+	NumericProjectID string   `json:"numeric_project_id" yaml:"numeric_project_id"` // project/numeric-project-id
+	Macs             []string `json:"macs" yaml:"macs"`
+}
+
+func init() {
+	cloudprovider.RegisterDetails(cloudprovider.CloudProvider_Gcp, func() cloudprovider.ProviderDetails { return &AdditionalInfo{} })
+}
+
+// Returns the GCP details of info, nil if info was not produced by the GCP provider
+func GetDetails(info *cloudprovider.MachineInfo) *AdditionalInfo {
+	details, _ := info.Details.(*AdditionalInfo)
+	return details
+}
+
+func (info *AdditionalInfo) ToArr() []cloudprovider.AdditionalParam {
+	return []cloudprovider.AdditionalParam{
+		{Key: "InstanceType", Value: info.InstanceType},
+		{Key: "Name", Value: info.Name},
+		{Key: "Hostname", Value: info.Hostname},
+		{Key: "ImageID", Value: info.ImageID},
+		{Key: "CpuPlatform", Value: info.CpuPlatform},
+		{Key: "ProjectID", Value: info.ProjectID},
+		{Key: "NumericProjectID", Value: info.NumericProjectID},
+		{Key: "MACs", Value: fmt.Sprintf("%v", info.Macs)},
+	}
+}
+
+type GcpServiceProvider struct {
+	baseURL string
+	retry   *util.RetryPolicy
+	info    *cloudprovider.MachineInfo
+}
+
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*GcpServiceProvider)(nil)
+
+func NewGcpServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
+	return NewGcpServiceProviderWithEndpoint("")
+}
+
+// endpoint is the scheme and host of the metadata server, e.g. http://127.0.0.1:8080, util.GCEMetadataEndpoint() if empty
+func NewGcpServiceProviderWithEndpoint(endpoint string) cloudprovider.ICloudProviderVirtualMachine {
+	return NewGcpServiceProviderWithOptions(util.MetadataClientOptions{Endpoint: endpoint})
+}
+
+func NewGcpServiceProviderWithOptions(opts util.MetadataClientOptions) cloudprovider.ICloudProviderVirtualMachine {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = util.GCEMetadataEndpoint()
+	}
+	return &GcpServiceProvider{baseURL: strings.TrimRight(endpoint, "/") + metadataPath, retry: opts.Retry}
+}
+
+func (provider *GcpServiceProvider) GetName() cloudprovider.CloudProviderType {
+	return cloudprovider.CloudProvider_Gcp
+}
+
+func (provider *GcpServiceProvider) Init() error {
+	return provider.InitContext(context.Background())
+}
+
+func (provider *GcpServiceProvider) InitContext(ctx context.Context) error {
+	s, err := provider.getMetadata(ctx, "instance/?recursive=true")
+	if err != nil {
+		return err
+	}
+
+	var data GcpMetaDataInstance
+	if err = json.Unmarshal([]byte(s), &data); err != nil {
+		return fmt.Errorf("%w: invalid instance metadata: %v", util.ErrNotDetected, err)
+	}
+
+	projectID, err := provider.getMetadata(ctx, "project/project-id")
+	if err != nil {
+		return err
+	}
+	numericProjectID, _ := provider.getMetadata(ctx, "project/numeric-project-id")
+
+	zone := lastPathSegment(data.Zone)
+	additionalInfo := &AdditionalInfo{
+		InstanceType:     lastPathSegment(data.MachineType),
+		Name:             data.Name,
+		Hostname:         data.Hostname,
+		ImageID:          data.Image,
+		CpuPlatform:      data.CpuPlatform,
+		ProjectID:        projectID,
+		NumericProjectID: numericProjectID,
+		Macs:             data.GetMacs(),
+	}
+
+	provider.info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
+		InstanceID:   data.ID.String(),
+		Zone:         zone,
+		Region:       regionFromZone(zone),
+		Architecture: "",
+		IPAddresses:  data.GetPrivateIPs(),
+		PublicDNS:    data.GetPublicIP(),
+		Cluster:      data.Attributes[clusterNameAttrKey],
+		Disks:        cloudprovider.GetBlockDevices(),
+		Additional:   additionalInfo.ToArr(),
+		Details:      additionalInfo,
+	}
+	return nil
+}
+
+func (provider *GcpServiceProvider) GetMachineInfo() (*cloudprovider.MachineInfo, error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *GcpServiceProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	if provider.info == nil {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	return provider.info, nil
+}
+
+func (provider *GcpServiceProvider) GetVirtualMachineID() (instanceId string, err error) {
+	return cloudprovider.GetVirtualMachineID(provider)
+}
+
+func (provider *GcpServiceProvider) getMetadata(ctx context.Context, relativePath string) (result string, err error) {
+	err = util.RetryPolicyOrDefault(provider.retry).Do(ctx, func() (err error) {
+		result, _, err = provider.getMetadataOnce(ctx, util.MetadataHTTPClient, relativePath)
+		return
+	})
+	return
+}
+
+// Returns the value and its ETag, which is empty if the server sent none
+func (provider *GcpServiceProvider) getMetadataOnce(ctx context.Context, client *http.Client, relativePath string) (string, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(`%v/%v`, provider.baseURL, relativePath), nil)
+	if err != nil {
+		return "", "", err
+	}
+	request.Header.Add(metadataFlavorKey, metadataFlavorGCE)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", "", util.NewRequestError(request, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return "", "", util.NewStatusError(request, response)
+	}
+	// Anything answering on the metadata host without the flavor header is not the GCE metadata server
+	if response.Header.Get(metadataFlavorKey) != metadataFlavorGCE {
+		return "", "", fmt.Errorf(`%v: missing %v response header: %w`, request.URL, metadataFlavorKey, util.ErrNotDetected)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", "", err
+	}
+	return string(body), response.Header.Get("ETag"), nil
+}
+
+// "projects/123456789/zones/us-central1-a" -> "us-central1-a"
+func lastPathSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// "us-central1-a" -> "us-central1"
+func regionFromZone(zone string) string {
+	i := strings.LastIndex(zone, "-")
+	if i < 0 {
+		return zone
+	}
+	return zone[:i]
+}
+
+// The format of json
+// https://cloud.google.com/compute/docs/metadata/predefined-metadata-keys
+// Can be retrieved with
+//
+//	curl -H "Metadata-Flavor: Google" "http://metadata.google.internal/computeMetadata/v1/instance/?recursive=true" | json_pp | less
+type GcpMetaDataInstance struct {
+	ID                json.Number                   `json:"id"`
+	Name              string                        `json:"name"`
+	Hostname          string                        `json:"hostname"`
+	Zone              string                        `json:"zone"`
+	MachineType       string                        `json:"machineType"`
+	Image             string                        `json:"image"`
+	CpuPlatform       string                        `json:"cpuPlatform"`
+	Attributes        map[string]string             `json:"attributes"`
+	NetworkInterfaces []GcpMetaDataNetworkInterface `json:"networkInterfaces"`
+}
+
+func (data *GcpMetaDataInstance) GetPrivateIPs() []string {
+	ips := make([]string, 0, len(data.NetworkInterfaces))
+	for i := range data.NetworkInterfaces {
+		if data.NetworkInterfaces[i].IP != "" {
+			ips = append(ips, data.NetworkInterfaces[i].IP)
+		}
+	}
+	return ips
+}
+
+func (data *GcpMetaDataInstance) GetPublicIP() string {
+	for i := range data.NetworkInterfaces {
+		for _, cfg := range data.NetworkInterfaces[i].AccessConfigs {
+			if cfg.ExternalIP != "" {
+				return cfg.ExternalIP
+			}
+		}
+	}
+	return ""
+}
+
+func (data *GcpMetaDataInstance) GetMacs() []string {
+	macs := make([]string, 0, len(data.NetworkInterfaces))
+	for i := range data.NetworkInterfaces {
+		macs = append(macs, data.NetworkInterfaces[i].Mac)
+	}
+	return macs
+}
+
+type GcpMetaDataNetworkInterface struct {
+	IP            string                    `json:"ip"`
+	Mac           string                    `json:"mac"`
+	Network       string                    `json:"network"`
+	Subnetmask    string                    `json:"subnetmask"`
+	Gateway       string                    `json:"gateway"`
+	AccessConfigs []GcpMetaDataAccessConfig `json:"accessConfigs"`
+}
+
+type GcpMetaDataAccessConfig struct {
+	ExternalIP string `json:"externalIp"`
+	Type       string `json:"type"`
+}
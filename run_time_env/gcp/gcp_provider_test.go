@@ -0,0 +1,142 @@
+package gcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+const testInstanceJSON = `{
+	"id": 4520031799277581759,
+	"name": "vlz-node-1",
+	"hostname": "vlz-node-1.c.vlz-project.internal",
+	"zone": "projects/123456789012/zones/us-central1-a",
+	"machineType": "projects/123456789012/machineTypes/n2-standard-8",
+	"image": "projects/debian-cloud/global/images/debian-12-bookworm-v20240110",
+	"cpuPlatform": "Intel Cascade Lake",
+	"attributes": {"cluster-name": "vlz-gke"},
+	"networkInterfaces": [
+		{"ip": "10.128.0.7", "mac": "42:01:0a:80:00:07", "network": "projects/123456789012/networks/default",
+		 "accessConfigs": [{"externalIp": "34.68.1.2", "type": "ONE_TO_ONE_NAT"}]},
+		{"ip": "10.130.0.3", "mac": "42:01:0a:82:00:03", "network": "projects/123456789012/networks/storage"}
+	]
+}`
+
+func newMetadataServer(t *testing.T, flavor string) *httptest.Server {
+	responses := map[string]string{
+		"/computeMetadata/v1/instance/":                  testInstanceJSON,
+		"/computeMetadata/v1/project/project-id":         "vlz-project",
+		"/computeMetadata/v1/project/numeric-project-id": "123456789012",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(metadataFlavorKey) != metadataFlavorGCE {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if flavor != "" {
+			w.Header().Set(metadataFlavorKey, flavor)
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGcpServiceProvider(t *testing.T) {
+	server := newMetadataServer(t, metadataFlavorGCE)
+	sysfs := t.TempDir()
+	disk := filepath.Join(sysfs, "block", "nvme0n1")
+	if err := os.MkdirAll(filepath.Join(disk, "device"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(disk, "size"), []byte("20971520\n"), 0644)
+	os.WriteFile(filepath.Join(disk, "device", "model"), []byte("nvme_card-pd\n"), 0644)
+	cloudprovider.SetSysfsRoot(sysfs)
+	defer cloudprovider.SetSysfsRoot("")
+
+	provider := &GcpServiceProvider{baseURL: server.URL + "/computeMetadata/v1"}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	info, err := provider.GetMachineInfo()
+	if err != nil {
+		t.Fatalf("GetMachineInfo failed: %v", err)
+	}
+
+	if info.InstanceID != "4520031799277581759" {
+		t.Errorf("InstanceID = %v", info.InstanceID)
+	}
+	if info.Zone != "us-central1-a" || info.Region != "us-central1" {
+		t.Errorf("Zone = %v, Region = %v", info.Zone, info.Region)
+	}
+	if !reflect.DeepEqual(info.IPAddresses, []string{"10.128.0.7", "10.130.0.3"}) {
+		t.Errorf("IPAddresses = %v", info.IPAddresses)
+	}
+	if len(info.Disks) != 1 || info.Disks[0].Model != "nvme_card-pd" {
+		t.Errorf("Disks = %+v", info.Disks)
+	}
+	if info.PublicDNS != "34.68.1.2" {
+		t.Errorf("PublicDNS = %v", info.PublicDNS)
+	}
+	if info.Cluster != "vlz-gke" {
+		t.Errorf("Cluster = %v", info.Cluster)
+	}
+
+	additional := map[string]string{}
+	for _, p := range info.Additional {
+		additional[p.Key] = p.Value
+	}
+	if additional["InstanceType"] != "n2-standard-8" || additional["ProjectID"] != "vlz-project" {
+		t.Errorf("Additional = %v", info.Additional)
+	}
+
+	details := GetDetails(info)
+	if details == nil || details.InstanceType != "n2-standard-8" || len(details.Macs) == 0 {
+		t.Fatalf("Details = %+v", info.Details)
+	}
+	data, err := info.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := cloudprovider.MachineInfoFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(GetDetails(decoded), details) {
+		t.Errorf("decoded Details = %+v, want %+v", decoded.Details, details)
+	}
+}
+
+func TestGcpServiceProviderRequiresFlavorHeader(t *testing.T) {
+	server := newMetadataServer(t, "")
+
+	provider := &GcpServiceProvider{baseURL: server.URL + "/computeMetadata/v1"}
+	if err := provider.Init(); err == nil {
+		t.Fatal("Init succeeded against a server without the Metadata-Flavor response header")
+	}
+	if _, err := provider.GetMachineInfo(); err == nil {
+		t.Fatal("GetMachineInfo succeeded on an uninitialized provider")
+	}
+}
+
+func TestRegionFromZone(t *testing.T) {
+	for zone, region := range map[string]string{
+		"us-central1-a":  "us-central1",
+		"europe-west4-b": "europe-west4",
+		"":               "",
+	} {
+		if got := regionFromZone(zone); got != region {
+			t.Errorf("regionFromZone(%q) = %q, want %q", zone, got, region)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+const (
+	// Google's token signing certificates, a JSON object of key id -> PEM certificate.
+	// Fetched by the verifying party, see ParseGoogleCertificates
+	GoogleCertificatesURL = "https://www.googleapis.com/oauth2/v1/certs"
+
+	googleIssuer         = "https://accounts.google.com"
+	identityTokenLeeway  = 5 * time.Minute
+	identityTokenAccount = "default"
+)
+
+// Claims of an identity token requested with format=full
+// https://cloud.google.com/compute/docs/instances/verifying-instance-identity
+type IdentityClaims struct {
+	Issuer          string `json:"iss"`
+	Audience        string `json:"aud"`
+	AuthorizedParty string `json:"azp"`
+	Subject         string `json:"sub"`
+	Email           string `json:"email"`
+	IssuedAt        int64  `json:"iat"`
+	Expiry          int64  `json:"exp"`
+	Google          struct {
+		ComputeEngine struct {
+			InstanceID                string `json:"instance_id"`
+			InstanceName              string `json:"instance_name"`
+			ProjectID                 string `json:"project_id"`
+			ProjectNumber             int64  `json:"project_number"`
+			Zone                      string `json:"zone"`
+			InstanceCreationTimestamp int64  `json:"instance_creation_timestamp"`
+		} `json:"compute_engine"`
+	} `json:"google"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Requests an identity token of the default service account for audience, including the instance details
+func (provider *GcpServiceProvider) GetIdentityToken(audience string) (string, error) {
+	return provider.GetIdentityTokenContext(context.Background(), audience)
+}
+
+func (provider *GcpServiceProvider) GetIdentityTokenContext(ctx context.Context, audience string) (string, error) {
+	if provider.info == nil {
+		return "", fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	return provider.getMetadata(ctx, fmt.Sprintf(`instance/service-accounts/%v/identity?audience=%v&format=full`,
+		identityTokenAccount, url.QueryEscape(audience)))
+}
+
+var _ cloudprovider.IAttester = (*GcpServiceProvider)(nil)
+
+// Returns an identity token with the nonce as audience, verify it with VerifyAttestationBundle
+func (provider *GcpServiceProvider) AttestIdentity(ctx context.Context, nonce string) (*cloudprovider.AttestationBundle, error) {
+	token, err := provider.GetIdentityTokenContext(ctx, nonce)
+	if err != nil {
+		return nil, err
+	}
+	bundle := cloudprovider.NewAttestationBundle(provider.GetName(), cloudprovider.AttestationFormat_GCPIdentityToken, nonce, provider.info.InstanceID)
+	bundle.Signature = strings.TrimSpace(token)
+	return bundle, nil
+}
+
+// Verifies a GCP bundle: the token signature, the nonce audience and that it names the bundle's instance
+func VerifyAttestationBundle(bundle *cloudprovider.AttestationBundle, keys map[string]*rsa.PublicKey, now time.Time) (*IdentityClaims, error) {
+	if bundle.Format != cloudprovider.AttestationFormat_GCPIdentityToken {
+		return nil, fmt.Errorf("%w: %v bundle is not a GCP identity token", cloudprovider.ErrInvalidConfig, bundle.Format)
+	}
+	claims, err := VerifyIdentityToken(bundle.Signature, bundle.Nonce, keys, now)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Google.ComputeEngine.InstanceID != bundle.InstanceID {
+		return nil, fmt.Errorf("%w: bundle of %v holds the identity token of %q", cloudprovider.ErrAttestationMismatch,
+			bundle.InstanceID, claims.Google.ComputeEngine.InstanceID)
+	}
+	return claims, nil
+}
+
+// Parses the content of GoogleCertificatesURL
+func ParseGoogleCertificates(data []byte) (map[string]*rsa.PublicKey, error) {
+	certificates := map[string]string{}
+	if err := json.Unmarshal(data, &certificates); err != nil {
+		return nil, fmt.Errorf("%w: Google certificates: %v", cloudprovider.ErrInvalidConfig, err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for keyID, data := range certificates {
+		block, _ := pem.Decode([]byte(data))
+		if block == nil {
+			return nil, fmt.Errorf("%w: Google certificate %v: no PEM certificate", cloudprovider.ErrInvalidConfig, keyID)
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: Google certificate %v: %v", cloudprovider.ErrInvalidConfig, keyID, err)
+		}
+		key, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: Google certificate %v: not an RSA key", cloudprovider.ErrInvalidConfig, keyID)
+		}
+		keys[keyID] = key
+	}
+	return keys, nil
+}
+
+// Verifies an RS256 identity token issued by Google for audience, keys maps key ids to Google's keys.
+// now is time.Now() if zero
+func VerifyIdentityToken(token string, audience string, keys map[string]*rsa.PublicKey, now time.Time) (*IdentityClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: identity token is not a JWT", cloudprovider.ErrInvalidSignature)
+	}
+	var header tokenHeader
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported identity token algorithm %q", cloudprovider.ErrInvalidSignature, header.Algorithm)
+	}
+	key, ok := keys[header.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown identity token key %q", cloudprovider.ErrUntrustedCertificate, header.KeyID)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: identity token signature: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: identity token: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+
+	claims := &IdentityClaims{}
+	if err = decodeTokenPart(parts[1], claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != googleIssuer && claims.Issuer != strings.TrimPrefix(googleIssuer, "https://") {
+		return nil, fmt.Errorf("%w: identity token issued by %q", cloudprovider.ErrUntrustedCertificate, claims.Issuer)
+	}
+	if claims.Audience != audience {
+		return nil, fmt.Errorf("%w: identity token audience %q, expected %q", cloudprovider.ErrAttestationMismatch, claims.Audience, audience)
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	issuedAt, expiry := time.Unix(claims.IssuedAt, 0), time.Unix(claims.Expiry, 0)
+	if now.Before(issuedAt.Add(-identityTokenLeeway)) || now.After(expiry.Add(identityTokenLeeway)) {
+		return nil, fmt.Errorf("%w: identity token is valid from %v to %v", cloudprovider.ErrAttestationMismatch,
+			issuedAt.UTC().Format(time.RFC3339), expiry.UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: identity token: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: identity token: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	return nil
+}
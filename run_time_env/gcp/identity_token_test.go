@@ -0,0 +1,138 @@
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+type testTokenIssuer struct {
+	t     *testing.T
+	keyID string
+	key   *rsa.PrivateKey
+	now   time.Time
+}
+
+func newTestTokenIssuer(t *testing.T) *testTokenIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTokenIssuer{t: t, keyID: "f5f7bd5e4b1fc2b3c4e1c8f0", key: key, now: time.Now().Truncate(time.Second)}
+}
+
+// The certificates document of GoogleCertificatesURL
+func (issuer *testTokenIssuer) certificates() []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken.system.gserviceaccount.com"},
+		NotBefore:    issuer.now.Add(-time.Hour),
+		NotAfter:     issuer.now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &issuer.key.PublicKey, issuer.key)
+	if err != nil {
+		issuer.t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{issuer.keyID: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))})
+	return data
+}
+
+func (issuer *testTokenIssuer) token(audience string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"alg":"RS256","kid":"%v","typ":"JWT"}`, issuer.keyID)))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud":"%v","azp":"110672468235732071045",
+		"email":"123456789012-compute@developer.gserviceaccount.com","exp":%v,"iat":%v,"iss":"https://accounts.google.com",
+		"sub":"110672468235732071045","google":{"compute_engine":{"instance_creation_timestamp":1704873600,
+		"instance_id":"4520031799277581759","instance_name":"vlz-node-1","project_id":"vlz-project",
+		"project_number":123456789012,"zone":"us-central1-a"}}}`, audience, issuer.now.Add(time.Hour).Unix(), issuer.now.Unix())))
+	digest := sha256.Sum256([]byte(header + "." + claims))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, issuer.key, crypto.SHA256, digest[:])
+	if err != nil {
+		issuer.t.Fatal(err)
+	}
+	return header + "." + claims + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyIdentityToken(t *testing.T) {
+	issuer := newTestTokenIssuer(t)
+	keys, err := ParseGoogleCertificates(issuer.certificates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := issuer.token("https://vlz.example.com/enroll")
+
+	claims, err := VerifyIdentityToken(token, "https://vlz.example.com/enroll", keys, issuer.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := claims.Google.ComputeEngine
+	if engine.InstanceID != "4520031799277581759" || engine.ProjectID != "vlz-project" || engine.Zone != "us-central1-a" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	if _, err = VerifyIdentityToken(token, "https://other.example.com", keys, issuer.now); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("other audience: %v", err)
+	}
+	if _, err = VerifyIdentityToken(token, "https://vlz.example.com/enroll", keys, issuer.now.Add(2*time.Hour)); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("expired: %v", err)
+	}
+	if _, err = VerifyIdentityToken(token, "https://vlz.example.com/enroll", map[string]*rsa.PublicKey{}, issuer.now); !errors.Is(err, cloudprovider.ErrUntrustedCertificate) {
+		t.Errorf("unknown key: %v", err)
+	}
+	tampered := token[:len(token)-4] + "AAAA"
+	if _, err = VerifyIdentityToken(tampered, "https://vlz.example.com/enroll", keys, issuer.now); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("tampered: %v", err)
+	}
+	if _, err = VerifyIdentityToken("not.a-token", "https://vlz.example.com/enroll", keys, issuer.now); !errors.Is(err, cloudprovider.ErrInvalidSignature) {
+		t.Errorf("not a JWT: %v", err)
+	}
+}
+
+func TestAttestIdentity(t *testing.T) {
+	issuer := newTestTokenIssuer(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(metadataFlavorKey) != metadataFlavorGCE || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/identity" ||
+			r.URL.Query().Get("format") != "full" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(metadataFlavorKey, metadataFlavorGCE)
+		w.Write([]byte(issuer.token(r.URL.Query().Get("audience"))))
+	}))
+	defer server.Close()
+	provider := &GcpServiceProvider{
+		baseURL: server.URL + "/computeMetadata/v1",
+		info:    &cloudprovider.MachineInfo{Provider: cloudprovider.CloudProvider_Gcp, InstanceID: "4520031799277581759"},
+	}
+
+	bundle, err := cloudprovider.Attest(context.Background(), provider, "enroll 42&x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Format != cloudprovider.AttestationFormat_GCPIdentityToken || bundle.InstanceID != "4520031799277581759" {
+		t.Errorf("bundle = %+v", bundle)
+	}
+	keys, _ := ParseGoogleCertificates(issuer.certificates())
+	if _, err = VerifyAttestationBundle(bundle, keys, issuer.now); err != nil {
+		t.Error(err)
+	}
+	bundle.InstanceID = "1"
+	if _, err = VerifyAttestationBundle(bundle, keys, issuer.now); !errors.Is(err, cloudprovider.ErrAttestationMismatch) {
+		t.Errorf("other instance: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+var _ cloudprovider.ILifecycleEventSource = (*GcpServiceProvider)(nil)
+
+// Values of instance/maintenance-event
+// https://cloud.google.com/compute/docs/instances/host-maintenance-overview#maintenanceevent
+const (
+	MaintenanceEvent_None      = "NONE"
+	MaintenanceEvent_Migrate   = "MIGRATE_ON_HOST_MAINTENANCE"
+	MaintenanceEvent_Terminate = "TERMINATE_ON_HOST_MAINTENANCE"
+)
+
+const (
+	maintenanceEventKey = "instance/maintenance-event"
+	preemptedKey        = "instance/preempted"
+	preemptedTrue       = "TRUE"
+	// How long the metadata server holds a wait_for_change request without a change
+	watchTimeoutSeconds = 60
+)
+
+// Waits for wait_for_change answers, util.MetadataHTTPClient would give up after a few seconds
+var watchHTTPClient = &http.Client{Timeout: (watchTimeoutSeconds + 10) * time.Second}
+
+// Delay before a failed wait is sent again, and between requests when the server sends no ETag
+var watchRetryDelay = 5 * time.Second
+
+// Watches instance/maintenance-event and instance/preempted, an event is reported when the value
+// changes from NONE or FALSE, or to another maintenance kind
+func (provider *GcpServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wait sync.WaitGroup
+	defer wait.Wait()
+	defer cancel()
+
+	maintenance := make(chan string)
+	preempted := make(chan string)
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		provider.watchMetadata(ctx, maintenanceEventKey, maintenance)
+	}()
+	go func() {
+		defer wait.Done()
+		provider.watchMetadata(ctx, preemptedKey, preempted)
+	}()
+
+	lastMaintenance, lastPreempted := MaintenanceEvent_None, "FALSE"
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case value := <-maintenance:
+			if value != lastMaintenance && value != MaintenanceEvent_None {
+				handler(maintenanceToLifecycleEvent(value))
+			}
+			lastMaintenance = value
+		case value := <-preempted:
+			if value != lastPreempted && value == preemptedTrue {
+				handler(&cloudprovider.LifecycleEvent{
+					Provider:    cloudprovider.CloudProvider_Gcp,
+					Type:        cloudprovider.LifecycleEvent_Preemption,
+					Started:     true,
+					Description: "preemptible instance is being stopped",
+					Source:      value,
+				})
+			}
+			lastPreempted = value
+		}
+	}
+}
+
+// Sends the current value of key and then every change until ctx is done.
+// Failures, e.g. while the metadata server restarts, are retried after watchRetryDelay
+func (provider *GcpServiceProvider) watchMetadata(ctx context.Context, key string, values chan<- string) {
+	etag := ""
+	for {
+		relativePath := key
+		if etag != "" {
+			relativePath = fmt.Sprintf("%v?wait_for_change=true&last_etag=%v&timeout_sec=%v", key, url.QueryEscape(etag), watchTimeoutSeconds)
+		}
+		value, nextEtag, err := provider.getMetadataOnce(ctx, watchHTTPClient, relativePath)
+		if err == nil {
+			select {
+			case values <- strings.TrimSpace(value):
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != nil || nextEtag == "" {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryDelay):
+			}
+		}
+		if err == nil {
+			etag = nextEtag
+		}
+	}
+}
+
+func maintenanceToLifecycleEvent(value string) *cloudprovider.LifecycleEvent {
+	event := &cloudprovider.LifecycleEvent{
+		Provider:    cloudprovider.CloudProvider_Gcp,
+		Type:        cloudprovider.LifecycleEvent_Maintenance,
+		Description: "host maintenance: " + value,
+		Source:      value,
+	}
+	switch value {
+	case MaintenanceEvent_Migrate:
+		event.Type = cloudprovider.LifecycleEvent_Freeze
+		event.Description = "live migration to another host"
+	case MaintenanceEvent_Terminate:
+		event.Description = "the instance is stopped for host maintenance"
+	}
+	return event
+}
@@ -0,0 +1,72 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+// Answers each key with its values in turn, a wait_for_change request for the current ETag
+// is answered with the next value or held until the client gives up
+func newWatchServer(t *testing.T, values map[string][]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path[len(metadataPath)+1:]
+		index := 0
+		if r.URL.Query().Get("wait_for_change") == "true" {
+			if r.URL.Query().Get("timeout_sec") == "" {
+				t.Errorf("%v: wait without timeout_sec", r.URL)
+			}
+			for _, c := range r.URL.Query().Get("last_etag") {
+				index = int(c-'0') + 1
+			}
+		}
+		if index >= len(values[key]) {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set(metadataFlavorKey, metadataFlavorGCE)
+		w.Header().Set("ETag", string(rune('0'+index)))
+		w.Write([]byte(values[key][index]))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGcpWatchLifecycleEvents(t *testing.T) {
+	server := newWatchServer(t, map[string][]string{
+		maintenanceEventKey: {MaintenanceEvent_None, MaintenanceEvent_Migrate, MaintenanceEvent_Migrate, MaintenanceEvent_None},
+		preemptedKey:        {"FALSE", "TRUE"},
+	})
+	provider := &GcpServiceProvider{baseURL: server.URL + metadataPath}
+
+	events := make(chan *cloudprovider.LifecycleEvent, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- provider.WatchLifecycleEvents(ctx, func(event *cloudprovider.LifecycleEvent) { events <- event })
+	}()
+
+	want := map[cloudprovider.LifecycleEventType]bool{cloudprovider.LifecycleEvent_Freeze: true, cloudprovider.LifecycleEvent_Preemption: true}
+	for len(want) > 0 {
+		select {
+		case event := <-events:
+			if !want[event.Type] || event.Provider != cloudprovider.CloudProvider_Gcp {
+				t.Fatalf("unexpected event %v", event)
+			}
+			delete(want, event.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing events %v", want)
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchLifecycleEvents() = %v, want context.Canceled", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("unexpected event %v, want an unchanged value to be reported once", <-events)
+	}
+}
@@ -0,0 +1,16 @@
+package oci
+
+import (
+	"context"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+var _ cloudprovider.ILifecycleEventSource = (*OciServiceProvider)(nil)
+
+// The OCI instance metadata has no maintenance or preemption notices, they are only published
+// through the OCI Events service. Blocks until ctx is done
+func (provider *OciServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,244 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+const (
+	metadataPath        = "/opc/v2"
+	authorizationKey    = "Authorization"
+	authorizationIMDSv2 = "Bearer Oracle"
+)
+
+// OCI details of MachineInfo, see GetDetails
+type AdditionalInfo struct {
+	InstanceType  string   `json:"instance_type" yaml:"instance_type"`   // Instance.Shape
+	DisplayName   string   `json:"display_name" yaml:"display_name"`     // Instance.DisplayName
+	Hostname      string   `json:"hostname" yaml:"hostname"`             // Instance.Hostname, not a resolvable public DNS name
+	ImageID       string   `json:"image_id" yaml:"image_id"`             // Instance.Image
+	CompartmentID string   `json:"compartment_id" yaml:"compartment_id"` // Instance.CompartmentID
+	FaultDomain   string   `json:"fault_domain" yaml:"fault_domain"`     // Instance.FaultDomain
+	LocalDisks    string   `json:"local_disks" yaml:"local_disks"`       // Instance.ShapeConfig.LocalDiskDescription
+	Macs          []string `json:"macs" yaml:"macs"`
+}
+
+func init() {
+	cloudprovider.RegisterDetails(cloudprovider.CloudProvider_Oci, func() cloudprovider.ProviderDetails { return &AdditionalInfo{} })
+}
+
+// Returns the OCI details of info, nil if info was not produced by the OCI provider
+func GetDetails(info *cloudprovider.MachineInfo) *AdditionalInfo {
+	details, _ := info.Details.(*AdditionalInfo)
+	return details
+}
+
+func (info *AdditionalInfo) ToArr() []cloudprovider.AdditionalParam {
+	return []cloudprovider.AdditionalParam{
+		{Key: "InstanceType", Value: info.InstanceType},
+		{Key: "DisplayName", Value: info.DisplayName},
+		{Key: "Hostname", Value: info.Hostname},
+		{Key: "ImageID", Value: info.ImageID},
+		{Key: "CompartmentID", Value: info.CompartmentID},
+		{Key: "FaultDomain", Value: info.FaultDomain},
+		{Key: "LocalDisks", Value: info.LocalDisks},
+		{Key: "MACs", Value: fmt.Sprintf("%v", info.Macs)},
+	}
+}
+
+type OciServiceProvider struct {
+	baseURL string
+	retry   *util.RetryPolicy
+	info    *cloudprovider.MachineInfo
+}
+
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*OciServiceProvider)(nil)
+
+func NewOciServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
+	return NewOciServiceProviderWithEndpoint("")
+}
+
+// endpoint is the scheme and host of the metadata server, e.g. http://[fd00:c1::a9fe:a9fe], util.OCIMetadataEndpoint() if empty
+func NewOciServiceProviderWithEndpoint(endpoint string) cloudprovider.ICloudProviderVirtualMachine {
+	return NewOciServiceProviderWithOptions(util.MetadataClientOptions{Endpoint: endpoint})
+}
+
+func NewOciServiceProviderWithOptions(opts util.MetadataClientOptions) cloudprovider.ICloudProviderVirtualMachine {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = util.OCIMetadataEndpoint()
+	}
+	return &OciServiceProvider{baseURL: strings.TrimRight(endpoint, "/") + metadataPath, retry: opts.Retry}
+}
+
+func (provider *OciServiceProvider) GetName() cloudprovider.CloudProviderType {
+	return cloudprovider.CloudProvider_Oci
+}
+
+func (provider *OciServiceProvider) Init() error {
+	return provider.InitContext(context.Background())
+}
+
+func (provider *OciServiceProvider) InitContext(ctx context.Context) error {
+	s, err := provider.getMetadata(ctx, "instance/")
+	if err != nil {
+		return err
+	}
+	var data OciMetaDataInstance
+	if err = json.Unmarshal([]byte(s), &data); err != nil {
+		return fmt.Errorf("%w: invalid instance metadata: %v", util.ErrNotDetected, err)
+	}
+
+	s, err = provider.getMetadata(ctx, "vnics/")
+	if err != nil {
+		return err
+	}
+	var vnics OciMetaDataVnics
+	if err = json.Unmarshal([]byte(s), &vnics); err != nil {
+		return fmt.Errorf("%w: invalid vnics metadata: %v", util.ErrNotDetected, err)
+	}
+
+	additionalInfo := &AdditionalInfo{
+		InstanceType:  data.Shape,
+		DisplayName:   data.DisplayName,
+		Hostname:      data.Hostname,
+		ImageID:       data.Image,
+		CompartmentID: data.CompartmentID,
+		FaultDomain:   data.FaultDomain,
+		LocalDisks:    data.ShapeConfig.LocalDiskDescription,
+		Macs:          vnics.GetMacs(),
+	}
+
+	zone := data.AvailabilityDomain
+	if data.FaultDomain != "" {
+		zone = fmt.Sprintf(`%v-%v`, data.AvailabilityDomain, data.FaultDomain) // fault domains are the placement unit inside an availability domain
+	}
+	region := data.CanonicalRegionName
+	if region == "" {
+		region = data.Region
+	}
+	provider.info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
+		InstanceID:   data.ID,
+		Zone:         zone,
+		Region:       region,
+		Architecture: "",
+		IPAddresses:  vnics.GetPrivateIPs(),
+		Disks:        cloudprovider.GetBlockDevices(),
+		Additional:   additionalInfo.ToArr(),
+		Details:      additionalInfo,
+	}
+	return nil
+}
+
+func (provider *OciServiceProvider) GetMachineInfo() (*cloudprovider.MachineInfo, error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *OciServiceProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	if provider.info == nil {
+		return nil, fmt.Errorf("%v: %w", provider.GetName(), cloudprovider.ErrNotDetected)
+	}
+	return provider.info, nil
+}
+
+func (provider *OciServiceProvider) GetVirtualMachineID() (instanceId string, err error) {
+	return cloudprovider.GetVirtualMachineID(provider)
+}
+
+func (provider *OciServiceProvider) getMetadata(ctx context.Context, relativePath string) (result string, err error) {
+	err = util.RetryPolicyOrDefault(provider.retry).Do(ctx, func() (err error) {
+		result, err = provider.getMetadataOnce(ctx, relativePath)
+		return
+	})
+	return
+}
+
+func (provider *OciServiceProvider) getMetadataOnce(ctx context.Context, relativePath string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(`%v/%v`, provider.baseURL, relativePath), nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Add(authorizationKey, authorizationIMDSv2)
+
+	response, err := util.MetadataHTTPClient.Do(request)
+	if err != nil {
+		return "", util.NewRequestError(request, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return "", util.NewStatusError(request, response)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// The format of json
+// https://docs.oracle.com/en-us/iaas/Content/Compute/Tasks/gettingmetadata.htm
+// Can be retrieved with
+//
+//	curl -H "Authorization: Bearer Oracle" http://169.254.169.254/opc/v2/instance/ | json_pp | less
+type OciMetaDataInstance struct {
+	ID                  string                 `json:"id"`
+	DisplayName         string                 `json:"displayName"`
+	Hostname            string                 `json:"hostname"`
+	AvailabilityDomain  string                 `json:"availabilityDomain"`
+	FaultDomain         string                 `json:"faultDomain"`
+	Region              string                 `json:"region"`
+	CanonicalRegionName string                 `json:"canonicalRegionName"`
+	CompartmentID       string                 `json:"compartmentId"`
+	Image               string                 `json:"image"`
+	Shape               string                 `json:"shape"`
+	ShapeConfig         OciMetaDataShapeConfig `json:"shapeConfig"`
+}
+
+type OciMetaDataShapeConfig struct {
+	Ocpus                    float64 `json:"ocpus"`
+	MemoryInGBs              float64 `json:"memoryInGBs"`
+	LocalDisks               int     `json:"localDisks"`
+	LocalDisksTotalSizeInGBs float64 `json:"localDisksTotalSizeInGBs"`
+	LocalDiskDescription     string  `json:"localDiskDescription"`
+}
+
+// curl -H "Authorization: Bearer Oracle" http://169.254.169.254/opc/v2/vnics/
+type OciMetaDataVnics []OciMetaDataVnic
+
+func (vnics OciMetaDataVnics) GetPrivateIPs() []string {
+	ips := make([]string, 0, len(vnics))
+	for i := range vnics {
+		if vnics[i].PrivateIP != "" {
+			ips = append(ips, vnics[i].PrivateIP)
+		}
+	}
+	return ips
+}
+
+func (vnics OciMetaDataVnics) GetMacs() []string {
+	macs := make([]string, 0, len(vnics))
+	for i := range vnics {
+		macs = append(macs, vnics[i].MacAddr)
+	}
+	return macs
+}
+
+type OciMetaDataVnic struct {
+	VnicID          string `json:"vnicId"`
+	PrivateIP       string `json:"privateIp"`
+	VlanTag         int    `json:"vlanTag"`
+	MacAddr         string `json:"macAddr"`
+	VirtualRouterIP string `json:"virtualRouterIp"`
+	SubnetCidrBlock string `json:"subnetCidrBlock"`
+	NicIndex        int    `json:"nicIndex"`
+}
@@ -0,0 +1,99 @@
+package oci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+const testInstanceJSON = `{
+	"id": "ocid1.instance.oc1.phx.anyhqljt",
+	"displayName": "vlz-dense-1",
+	"hostname": "vlz-dense-1",
+	"availabilityDomain": "Uocm:PHX-AD-1",
+	"faultDomain": "FAULT-DOMAIN-2",
+	"region": "phx",
+	"canonicalRegionName": "us-phoenix-1",
+	"compartmentId": "ocid1.compartment.oc1..aaaa",
+	"image": "ocid1.image.oc1.phx.aaaa",
+	"shape": "BM.DenseIO.E4.128",
+	"shapeConfig": {"ocpus": 128, "memoryInGBs": 2048, "localDisks": 8, "localDisksTotalSizeInGBs": 54400, "localDiskDescription": "8x 6.8TB NVMe SSD"}
+}`
+
+const testVnicsJSON = `[
+	{"vnicId": "ocid1.vnic.oc1.phx.a", "privateIp": "10.0.3.6", "vlanTag": 11, "macAddr": "00:00:17:00:00:01", "nicIndex": 0},
+	{"vnicId": "ocid1.vnic.oc1.phx.b", "privateIp": "10.0.4.9", "vlanTag": 12, "macAddr": "00:00:17:00:00:02", "nicIndex": 1}
+]`
+
+func TestOciServiceProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(authorizationKey) != authorizationIMDSv2 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/opc/v2/instance/":
+			w.Write([]byte(testInstanceJSON))
+		case "/opc/v2/vnics/":
+			w.Write([]byte(testVnicsJSON))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := &OciServiceProvider{baseURL: server.URL + "/opc/v2"}
+	if err := provider.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	info, err := provider.GetMachineInfo()
+	if err != nil {
+		t.Fatalf("GetMachineInfo failed: %v", err)
+	}
+
+	if info.InstanceID != "ocid1.instance.oc1.phx.anyhqljt" {
+		t.Errorf("InstanceID = %v", info.InstanceID)
+	}
+	if info.Zone != "Uocm:PHX-AD-1-FAULT-DOMAIN-2" || info.Region != "us-phoenix-1" {
+		t.Errorf("Zone = %v, Region = %v", info.Zone, info.Region)
+	}
+	if !reflect.DeepEqual(info.IPAddresses, []string{"10.0.3.6", "10.0.4.9"}) {
+		t.Errorf("IPAddresses = %v", info.IPAddresses)
+	}
+	if info.Additional[0].Key != "InstanceType" || info.Additional[0].Value != "BM.DenseIO.E4.128" {
+		t.Errorf("Additional = %v", info.Additional)
+	}
+	if info.PublicDNS != "" || GetDetails(info).Hostname != "vlz-dense-1" {
+		t.Errorf("PublicDNS = %v, Hostname = %v, want the hostname only in the details", info.PublicDNS, GetDetails(info).Hostname)
+	}
+}
+
+func TestOciServiceProviderRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		retry *util.RetryPolicy
+		want  int
+	}{
+		{&util.NoRetry, 1},
+		{&util.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}, 4},
+	} {
+		requests = 0
+		provider := NewOciServiceProviderWithOptions(util.MetadataClientOptions{Endpoint: server.URL, Retry: test.retry})
+		if err := provider.Init(); err == nil {
+			t.Fatal("Init succeeded against a failing server")
+		}
+		if requests != test.want {
+			t.Errorf("%v requests, want %v from the provider's retry policy", requests, test.want)
+		}
+	}
+}
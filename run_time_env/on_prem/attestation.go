@@ -0,0 +1,169 @@
+package on_prem
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+var _ cloudprovider.IAttester = (*onPremConfigServiceProvider)(nil)
+
+// The document an on premises machine signs with its configured key
+type LocalAttestationDocument struct {
+	Nonce      string    `json:"nonce"`
+	InstanceID string    `json:"instance_id"`
+	Zone       string    `json:"zone"`
+	Region     string    `json:"region"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Signs the nonce with the attestation_key_file of the config, ErrUnimplemented if none is configured.
+// The server trusts the key it enrolled for the instance, see VerifyAttestationBundle
+func (provider *onPremConfigServiceProvider) AttestIdentity(ctx context.Context, nonce string) (*cloudprovider.AttestationBundle, error) {
+	if provider.info == nil {
+		return nil, fmt.Errorf("no valid config file found: %w", cloudprovider.ErrNotDetected)
+	}
+	if provider.keyFile == "" {
+		return nil, fmt.Errorf("%v: no attestation_key_file configured: %w", provider.filename, cloudprovider.ErrUnimplemented)
+	}
+	key, err := loadSigningKey(provider.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %v", cloudprovider.ErrInvalidConfig, provider.keyFile, err)
+	}
+
+	bundle := cloudprovider.NewAttestationBundle(provider.GetName(), cloudprovider.AttestationFormat_LocalKey, nonce, provider.info.InstanceID)
+	document, err := json.Marshal(&LocalAttestationDocument{
+		Nonce:      nonce,
+		InstanceID: provider.info.InstanceID,
+		Zone:       provider.info.Zone,
+		Region:     provider.info.Region,
+		CreatedAt:  bundle.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signDocument(key, document)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Document = document
+	bundle.Signature = base64.StdEncoding.EncodeToString(signature)
+	bundle.PublicKey = publicKey
+	return bundle, nil
+}
+
+// Verifies a local key bundle with the key enrolled for the instance
+func VerifyAttestationBundle(bundle *cloudprovider.AttestationBundle, key crypto.PublicKey) (*LocalAttestationDocument, error) {
+	if bundle.Format != cloudprovider.AttestationFormat_LocalKey {
+		return nil, fmt.Errorf("%w: %v bundle is not signed by a local key", cloudprovider.ErrInvalidConfig, bundle.Format)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: no key enrolled for %v", cloudprovider.ErrUntrustedCertificate, bundle.InstanceID)
+	}
+	if len(bundle.PublicKey) > 0 {
+		enrolled, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: enrolled key of %v: %v", cloudprovider.ErrInvalidConfig, bundle.InstanceID, err)
+		}
+		if !bytes.Equal(enrolled, bundle.PublicKey) {
+			return nil, fmt.Errorf("%w: %v is signed by another key than the enrolled one", cloudprovider.ErrUntrustedCertificate, bundle.InstanceID)
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: local attestation signature is not base64: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	if err = verifySignature(key, bundle.Document, signature); err != nil {
+		return nil, err
+	}
+
+	document := &LocalAttestationDocument{}
+	if err = json.Unmarshal(bundle.Document, document); err != nil {
+		return nil, fmt.Errorf("%w: invalid local attestation document: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	if document.Nonce != bundle.Nonce || document.InstanceID != bundle.InstanceID {
+		return nil, fmt.Errorf("%w: bundle of %v for nonce %q holds the document of %v for nonce %q", cloudprovider.ErrAttestationMismatch,
+			bundle.InstanceID, bundle.Nonce, document.InstanceID, document.Nonce)
+	}
+	return document, nil
+}
+
+// Reads a PEM private key: PKCS #8 (RSA, ECDSA, Ed25519), PKCS #1 or SEC 1
+func loadSigningKey(filename string) (crypto.Signer, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation key: %v", cloudprovider.ErrInvalidConfig, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %v: no PEM private key", cloudprovider.ErrInvalidConfig, filename)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v: %v", cloudprovider.ErrInvalidConfig, filename, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v: unsupported key type %T", cloudprovider.ErrInvalidConfig, filename, key)
+	}
+	return signer, nil
+}
+
+// SHA-256 with PKCS #1 v1.5 or ASN.1 ECDSA signatures, Ed25519 signs the document itself
+func signDocument(key crypto.Signer, document []byte) ([]byte, error) {
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		return key.Sign(rand.Reader, document, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(document)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verifySignature(key crypto.PublicKey, document []byte, signature []byte) error {
+	digest := sha256.Sum256(document)
+	var err error
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			err = errors.New("ecdsa verification error")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, document, signature) {
+			err = errors.New("ed25519 verification error")
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", cloudprovider.ErrInvalidConfig, key)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: local attestation: %v", cloudprovider.ErrInvalidSignature, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package on_prem
+
+import (
+	"context"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+var (
+	_ cloudprovider.ILifecycleEventSource = (*onPremConfigServiceProvider)(nil)
+	_ cloudprovider.ILifecycleEventSource = (*onPremEnvServiceProvider)(nil)
+)
+
+// On premises machines get no notices, blocks until ctx is done
+func (provider *onPremConfigServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (provider *onPremEnvServiceProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
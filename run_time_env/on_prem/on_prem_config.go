@@ -1,6 +1,7 @@
 package on_prem
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,8 +23,12 @@ const (
 //         "zone": "z1",
 //         "region": "r1",
 //         "public_dns": "my_host.volumez.com"
-//     }
+//     },
+//     "attestation_key_file": "attestation.key"
 // }
+//
+// attestation_key_file is optional, a PEM private key (PKCS #8, PKCS #1 or EC) used by
+// AttestIdentity. Relative paths are relative to the config file
 
 type MachineInfo struct {
 	InstanceID string `json:"instance_id"`
@@ -33,15 +38,17 @@ type MachineInfo struct {
 }
 
 type Config struct {
-	Machine MachineInfo `json:"machine_info"`
+	Machine            MachineInfo `json:"machine_info"`
+	AttestationKeyFile string      `json:"attestation_key_file"`
 }
 
 type onPremConfigServiceProvider struct {
 	filename string
 	info     *MachineInfo
+	keyFile  string // absolute, empty if not configured
 }
 
-var _ cloudprovider.ICloudProviderVirtualMachine = (*onPremEnvServiceProvider)(nil)
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*onPremConfigServiceProvider)(nil)
 
 func NewOnPremConfigServiceProvider(filename string) cloudprovider.ICloudProviderVirtualMachine {
 	p := &onPremConfigServiceProvider{filename: filename}
@@ -57,23 +64,34 @@ func (provider *onPremConfigServiceProvider) GetName() cloudprovider.CloudProvid
 }
 
 func (provider *onPremConfigServiceProvider) Init() (err error) {
+	return provider.InitContext(context.Background())
+}
+
+func (provider *onPremConfigServiceProvider) InitContext(ctx context.Context) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	absPath, _ := filepath.Abs(provider.filename)
 	content, err := os.ReadFile(absPath)
 
 	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("%w: %v", cloudprovider.ErrNotDetected, err)
+		}
 		return
 	}
 
 	var config Config
 	err = json.Unmarshal(content, &config)
 	if err != nil {
+		err = fmt.Errorf("%v: %w: %v", provider.filename, cloudprovider.ErrInvalidConfig, err)
 		return
 	}
 	info := config.Machine
 
 	if info.Zone == "" {
 		// Required
-		err = errors.New(fmt.Sprintf(`%v: invalid config - zone parameter is required`, provider.filename))
+		err = fmt.Errorf(`%v: %w - zone parameter is required`, provider.filename, cloudprovider.ErrInvalidConfig)
 		return
 	}
 
@@ -82,25 +100,37 @@ func (provider *onPremConfigServiceProvider) Init() (err error) {
 		info.InstanceID = name
 	}
 
+	if config.AttestationKeyFile != "" {
+		provider.keyFile = config.AttestationKeyFile
+		if !filepath.IsAbs(provider.keyFile) {
+			provider.keyFile = filepath.Join(filepath.Dir(absPath), provider.keyFile)
+		}
+	}
 	provider.info = &info
 	return
 }
 
 func (provider *onPremConfigServiceProvider) GetMachineInfo() (info *cloudprovider.MachineInfo, err error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *onPremConfigServiceProvider) GetMachineInfoContext(ctx context.Context) (info *cloudprovider.MachineInfo, err error) {
 
 	if provider.info == nil {
-		return nil, errors.New("no valid config file found")
+		return nil, fmt.Errorf("no valid config file found: %w", cloudprovider.ErrNotDetected)
 	}
 
 	arch, _ := os.LookupEnv(architectureKey)
 
 	info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
 		InstanceID:   provider.info.InstanceID,
 		Zone:         provider.info.Zone,
 		Region:       provider.info.Region,
 		Architecture: arch,
 		IPAddresses:  []string{},
 		PublicDNS:    provider.info.PublicDNS,
+		Disks:        cloudprovider.GetBlockDevices(),
 		Additional:   nil,
 	}
 	return
@@ -1,7 +1,7 @@
 package on_prem
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"os"
 
@@ -19,7 +19,7 @@ type onPremEnvServiceProvider struct {
 	settings map[string]string
 }
 
-var _ cloudprovider.ICloudProviderVirtualMachine = (*onPremEnvServiceProvider)(nil)
+var _ cloudprovider.ICloudProviderVirtualMachineContext = (*onPremEnvServiceProvider)(nil)
 
 func NewOnPremEnvServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
 	p := &onPremEnvServiceProvider{}
@@ -31,6 +31,13 @@ func (provider *onPremEnvServiceProvider) GetName() cloudprovider.CloudProviderT
 }
 
 func (provider *onPremEnvServiceProvider) Init() (err error) {
+	return provider.InitContext(context.Background())
+}
+
+func (provider *onPremEnvServiceProvider) InitContext(ctx context.Context) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
 	keys := []string{
 		connectorZoneKey,
 		connectorRegionKey,
@@ -48,7 +55,7 @@ func (provider *onPremEnvServiceProvider) Init() (err error) {
 	}
 
 	if values[connectorZoneKey] == "" || values[connectorRegionKey] == "" {
-		err = errors.New(fmt.Sprintf(`%v or %v is not set`, connectorZoneKey, connectorRegionKey))
+		err = fmt.Errorf(`%v or %v is not set: %w`, connectorZoneKey, connectorRegionKey, cloudprovider.ErrNotDetected)
 		return
 	}
 
@@ -57,6 +64,10 @@ func (provider *onPremEnvServiceProvider) Init() (err error) {
 }
 
 func (provider *onPremEnvServiceProvider) GetMachineInfo() (info *cloudprovider.MachineInfo, err error) {
+	return provider.GetMachineInfoContext(context.Background())
+}
+
+func (provider *onPremEnvServiceProvider) GetMachineInfoContext(ctx context.Context) (info *cloudprovider.MachineInfo, err error) {
 
 	name, _ := os.Hostname() // ignore error
 
@@ -66,12 +77,14 @@ func (provider *onPremEnvServiceProvider) GetMachineInfo() (info *cloudprovider.
 	}
 
 	info = &cloudprovider.MachineInfo{
+		Provider:     provider.GetName(),
 		InstanceID:   instanceID,
 		Zone:         provider.settings[connectorZoneKey],
 		Region:       provider.settings[connectorRegionKey],
 		Architecture: provider.settings[architectureKey],
 		IPAddresses:  []string{},
 		PublicDNS:    name,
+		Disks:        cloudprovider.GetBlockDevices(),
 		Additional:   nil,
 	}
 	return
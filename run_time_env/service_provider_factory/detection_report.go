@@ -0,0 +1,130 @@
+package service_provider_factory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+// Outcome of a single provider during detection
+type DetectionAttempt struct {
+	Name     cloudprovider.CloudProviderType `json:"name"`
+	Order    int                             `json:"order"` // position in the priority order, starting at 1
+	Duration time.Duration                   `json:"duration"`
+	Err      error                           `json:"-"`
+	Error    string                          `json:"error,omitempty"` // Err as text, for structured logs
+	Chosen   bool                            `json:"chosen"`
+}
+
+// Explains why each supported provider was accepted or rejected
+type DetectionReport struct {
+	Attempts []DetectionAttempt                         `json:"attempts"`
+	Duration time.Duration                              `json:"duration"`
+	Provider cloudprovider.ICloudProviderVirtualMachine `json:"-"`
+	Err      error                                      `json:"-"`               // set when no provider was chosen
+	Error    string                                     `json:"error,omitempty"` // Err as text, for structured logs
+}
+
+func newDetectionReport(chosen cloudprovider.ICloudProviderVirtualMachine, results []ProbeResult, duration time.Duration) *DetectionReport {
+	report := &DetectionReport{
+		Attempts: make([]DetectionAttempt, 0, len(results)),
+		Duration: duration,
+		Provider: chosen,
+	}
+	for i := range results {
+		attempt := DetectionAttempt{
+			Order:    i + 1,
+			Duration: results[i].Duration,
+			Err:      results[i].Err,
+			Chosen:   chosen != nil && results[i].Provider == chosen,
+		}
+		if results[i].Provider != nil {
+			attempt.Name = results[i].Provider.GetName()
+		}
+		if attempt.Err != nil {
+			attempt.Error = attempt.Err.Error()
+		}
+		report.Attempts = append(report.Attempts, attempt)
+	}
+	if chosen == nil {
+		report.setErr(fmt.Errorf("no supported provider was detected: %w", cloudprovider.ErrNotDetected))
+	}
+	return report
+}
+
+func (report *DetectionReport) setErr(err error) {
+	report.Err = err
+	report.Error = err.Error()
+}
+
+// Name of the chosen provider, empty if none was detected
+func (report *DetectionReport) ChosenName() cloudprovider.CloudProviderType {
+	for i := range report.Attempts {
+		if report.Attempts[i].Chosen {
+			return report.Attempts[i].Name
+		}
+	}
+	return ""
+}
+
+func (attempt *DetectionAttempt) ToText() string {
+	status := "rejected"
+	if attempt.Chosen {
+		status = "CHOSEN"
+	} else if attempt.Err == nil {
+		status = "available"
+	} else if errors.Is(attempt.Err, errProbeAbandoned) {
+		status = "skipped"
+	}
+	text := fmt.Sprintf(`%-3v%-15v%-10v%v`, attempt.Order, attempt.Name, attempt.Duration.Round(time.Millisecond), status)
+	if attempt.Err != nil {
+		text = fmt.Sprintf(`%v: %v`, text, attempt.Err)
+	}
+	return text
+}
+
+func (report *DetectionReport) ToText() string {
+	chosen := report.ChosenName()
+	if chosen == "" {
+		chosen = "none"
+	}
+	arr := []string{fmt.Sprintf(`Detected provider: %v (%v)`, chosen, report.Duration.Round(time.Millisecond))}
+	if report.Err != nil {
+		arr = append(arr, fmt.Sprintf(`Error: %v`, report.Err))
+	}
+	for i := range report.Attempts {
+		arr = append(arr, report.Attempts[i].ToText())
+	}
+	return strings.Join(arr, "\n")
+}
+
+// Probes the supported providers (or the forced one) and reports the outcome of each one, without caching the result
+func DetectServiceProvider(opts ProbeOptions) *DetectionReport {
+	return DetectServiceProviderContext(context.Background(), opts)
+}
+
+func DetectServiceProviderContext(ctx context.Context, opts ProbeOptions) *DetectionReport {
+	start := time.Now()
+
+	opts, err := opts.resolve()
+	var providers []cloudprovider.ICloudProviderVirtualMachine
+	if err == nil {
+		providers, err = selectServiceProviders(opts)
+	}
+	if err != nil {
+		report := &DetectionReport{Attempts: []DetectionAttempt{}}
+		report.setErr(err)
+		return report
+	}
+
+	chosen, results := ProbeServiceProvidersContext(ctx, providers, opts)
+	report := newDetectionReport(chosen, results, time.Since(start))
+	if chosen == nil && opts.Provider != "" && len(results) == 1 {
+		report.setErr(fmt.Errorf("forced provider %v failed: %w", opts.Provider, results[0].Err))
+	}
+	return report
+}
@@ -0,0 +1,80 @@
+package service_provider_factory
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+// A running watch of the detected provider's lifecycle events
+type Subscription struct {
+	provider cloudprovider.ICloudProviderVirtualMachine
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mutex sync.Mutex
+	err   error
+}
+
+// Watches the lifecycle events of the detected provider until ctx is done or Close is called.
+// Providers without notices (on premises, OCI) deliver nothing, providers without an
+// implementation fail with cloudprovider.ErrUnimplemented
+func Subscribe(ctx context.Context, handler cloudprovider.LifecycleEventHandler) (*Subscription, error) {
+	provider, err := LookupServiceProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return SubscribeProvider(ctx, provider, handler)
+}
+
+func SubscribeProvider(ctx context.Context, provider cloudprovider.ICloudProviderVirtualMachine, handler cloudprovider.LifecycleEventHandler) (*Subscription, error) {
+	source, ok := provider.(cloudprovider.ILifecycleEventSource)
+	if !ok {
+		// reports ErrUnimplemented
+		return nil, cloudprovider.WatchLifecycleEvents(ctx, provider, handler)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	subscription := &Subscription{provider: provider, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(subscription.done)
+		err := source.WatchLifecycleEvents(ctx, handler)
+		subscription.mutex.Lock()
+		subscription.err = err
+		subscription.mutex.Unlock()
+	}()
+	return subscription, nil
+}
+
+func (subscription *Subscription) Provider() cloudprovider.ICloudProviderVirtualMachine {
+	return subscription.provider
+}
+
+// Closed once the watch stopped
+func (subscription *Subscription) Done() <-chan struct{} {
+	return subscription.done
+}
+
+// Why the watch stopped, nil while it is running or if it was closed
+func (subscription *Subscription) Err() error {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if errors.Is(subscription.err, context.Canceled) {
+		return nil
+	}
+	return subscription.err
+}
+
+// Expedites an event if the provider supports it, see cloudprovider.ILifecycleEventAcknowledger
+func (subscription *Subscription) Acknowledge(ctx context.Context, event *cloudprovider.LifecycleEvent) error {
+	return cloudprovider.AcknowledgeLifecycleEvent(ctx, subscription.provider, event)
+}
+
+// Stops the watch and waits for it
+func (subscription *Subscription) Close() error {
+	subscription.cancel()
+	<-subscription.done
+	return subscription.Err()
+}
@@ -0,0 +1,88 @@
+package service_provider_factory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/on_prem"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/service_provider_factory"
+)
+
+// Reports its events once and waits for cancellation
+type eventsProvider struct {
+	fakeProvider
+	events       []*cloudprovider.LifecycleEvent
+	acknowledged []string
+}
+
+func (provider *eventsProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	for _, event := range provider.events {
+		handler(event)
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (provider *eventsProvider) AcknowledgeLifecycleEvent(ctx context.Context, event *cloudprovider.LifecycleEvent) error {
+	provider.acknowledged = append(provider.acknowledged, event.ID)
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	preemption := &cloudprovider.LifecycleEvent{Provider: "fake", Type: cloudprovider.LifecycleEvent_Preemption, ID: "e1"}
+	provider := &eventsProvider{fakeProvider: fakeProvider{name: "fake"}, events: []*cloudprovider.LifecycleEvent{preemption}}
+
+	received := make(chan *cloudprovider.LifecycleEvent, 1)
+	subscription, err := service_provider_factory.SubscribeProvider(context.Background(), provider, func(event *cloudprovider.LifecycleEvent) {
+		received <- event
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-received:
+		if event != preemption {
+			t.Errorf("got %v", event)
+		}
+		if err := subscription.Acknowledge(context.Background(), event); err != nil || len(provider.acknowledged) != 1 {
+			t.Errorf("Acknowledge() = %v, acknowledged %v", err, provider.acknowledged)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	if err := subscription.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestSubscribeOnPrem(t *testing.T) {
+	t.Setenv("CONNECTOR_ZONE", "zone1")
+	t.Setenv("CONNECTOR_REGION", "region1")
+	provider := on_prem.NewOnPremEnvServiceProvider()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	subscription, err := service_provider_factory.SubscribeProvider(ctx, provider, func(event *cloudprovider.LifecycleEvent) {
+		t.Errorf("unexpected event %v", event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-subscription.Done()
+	if !errors.Is(subscription.Err(), context.DeadlineExceeded) {
+		t.Errorf("Err() = %v", subscription.Err())
+	}
+	if err := subscription.Acknowledge(ctx, &cloudprovider.LifecycleEvent{}); !errors.Is(err, cloudprovider.ErrUnimplemented) {
+		t.Errorf("Acknowledge() = %v", err)
+	}
+}
+
+func TestSubscribeUnimplemented(t *testing.T) {
+	_, err := service_provider_factory.SubscribeProvider(context.Background(), &fakeProvider{name: "fake"}, func(*cloudprovider.LifecycleEvent) {})
+	if !errors.Is(err, cloudprovider.ErrUnimplemented) {
+		t.Errorf("got %v", err)
+	}
+}
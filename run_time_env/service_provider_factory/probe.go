@@ -0,0 +1,157 @@
+package service_provider_factory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+type ProbeOptions struct {
+	Deadline        time.Duration // for the whole detection, DefaultProbeOptions.Deadline if zero
+	ProviderTimeout time.Duration // for a single provider's Init, DefaultProbeOptions.ProviderTimeout if zero
+	WaitForAll      bool          // keep probing lower priority providers after the outcome is known, for diagnostics
+
+	// Used by DetectServiceProvider, default to VLZ_CLOUD_PROVIDER and VLZ_CLOUD_PROVIDER_CANDIDATES
+	Provider   cloudprovider.CloudProviderType   // only this provider is used, detection fails if its Init fails
+	Candidates []cloudprovider.CloudProviderType // only these providers are probed, in registry order
+}
+
+var DefaultProbeOptions = ProbeOptions{
+	Deadline:        10 * time.Second,
+	ProviderTimeout: 5 * time.Second,
+}
+
+// A provider's Init or the whole detection ran past ProbeOptions.ProviderTimeout or Deadline
+var ErrProbeTimeout = errors.New("probe timed out")
+
+var errProbeAbandoned = errors.New("probe abandoned, a higher priority provider was chosen")
+
+// Zero durations are taken from DefaultProbeOptions
+func (opts ProbeOptions) withDefaults() ProbeOptions {
+	if opts.Deadline <= 0 {
+		opts.Deadline = DefaultProbeOptions.Deadline
+	}
+	if opts.ProviderTimeout <= 0 {
+		opts.ProviderTimeout = DefaultProbeOptions.ProviderTimeout
+	}
+	return opts
+}
+
+type ProbeResult struct {
+	Provider cloudprovider.ICloudProviderVirtualMachine
+	Duration time.Duration
+	Err      error
+}
+
+// Initializes all providers concurrently and returns the first one in the given (priority) order
+// that was initialized successfully, together with the result of every probe in the same order.
+// Detection stops as soon as the outcome of all providers preceding a successful one is known.
+func ProbeServiceProviders(providers []cloudprovider.ICloudProviderVirtualMachine, opts ProbeOptions) (chosen cloudprovider.ICloudProviderVirtualMachine, results []ProbeResult) {
+	return ProbeServiceProvidersContext(context.Background(), providers, opts)
+}
+
+// Same as ProbeServiceProviders, cancelling ctx (or reaching a timeout) cancels the providers' metadata lookups
+func ProbeServiceProvidersContext(ctx context.Context, providers []cloudprovider.ICloudProviderVirtualMachine, opts ProbeOptions) (chosen cloudprovider.ICloudProviderVirtualMachine, results []ProbeResult) {
+
+	type completion struct {
+		index    int
+		duration time.Duration
+		err      error
+	}
+
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Deadline)
+	defer cancel()
+
+	start := time.Now()
+	results = make([]ProbeResult, len(providers))
+	done := make([]bool, len(providers))
+	completions := make(chan completion, len(providers))
+
+	pending := 0
+	for i := range providers {
+		results[i].Provider = providers[i]
+		if providers[i] == nil {
+			done[i] = true
+			results[i].Err = errors.New("provider is nil")
+			continue
+		}
+		pending++
+		go func(index int, provider cloudprovider.ICloudProviderVirtualMachine) {
+			providerCtx, cancel := context.WithTimeout(ctx, opts.ProviderTimeout)
+			defer cancel()
+
+			// Providers that don't implement InitContext can't be cancelled, don't wait for them either
+			initDone := make(chan error, 1)
+			go func() {
+				initDone <- cloudprovider.InitContext(providerCtx, provider)
+			}()
+
+			var err error
+			select {
+			case err = <-initDone:
+			case <-providerCtx.Done():
+				err = contextError(fmt.Sprintf("%v: Init did not complete", provider.GetName()), providerCtx.Err())
+			}
+			completions <- completion{index: index, duration: time.Since(start), err: err}
+		}(i, providers[i])
+	}
+
+	for pending > 0 {
+		select {
+		case c := <-completions:
+			pending--
+			done[c.index] = true
+			results[c.index].Duration = c.duration
+			results[c.index].Err = c.err
+		case <-ctx.Done():
+			for i := range results {
+				if !done[i] {
+					results[i].Duration = time.Since(start)
+					results[i].Err = contextError(fmt.Sprintf("%v: detection did not complete", providers[i].GetName()), ctx.Err())
+				}
+			}
+			return firstSucceeded(results), results
+		}
+
+		if opts.WaitForAll {
+			continue
+		}
+		// Lower priority providers still running cannot change the outcome
+		for i := range results {
+			if !done[i] {
+				break
+			}
+			if results[i].Err == nil {
+				for j := i + 1; j < len(results); j++ {
+					if !done[j] {
+						results[j].Duration = time.Since(start)
+						results[j].Err = errProbeAbandoned
+					}
+				}
+				return providers[i], results
+			}
+		}
+	}
+	return firstSucceeded(results), results
+}
+
+// Deadlines are reported as ErrProbeTimeout, cancellation as is
+func contextError(msg string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%v: %w (%w)", msg, ErrProbeTimeout, err)
+	}
+	return fmt.Errorf("%v: %w", msg, err)
+}
+
+func firstSucceeded(results []ProbeResult) cloudprovider.ICloudProviderVirtualMachine {
+	for i := range results {
+		if results[i].Err == nil {
+			return results[i].Provider
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package service_provider_factory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/service_provider_factory"
+)
+
+type fakeProvider struct {
+	name  cloudprovider.CloudProviderType
+	delay time.Duration
+	err   error
+}
+
+func (provider *fakeProvider) GetName() cloudprovider.CloudProviderType {
+	return provider.name
+}
+
+func (provider *fakeProvider) Init() error {
+	time.Sleep(provider.delay)
+	return provider.err
+}
+
+func (provider *fakeProvider) GetVirtualMachineID() (string, error) {
+	return cloudprovider.GetVirtualMachineID(provider)
+}
+
+func (provider *fakeProvider) GetMachineInfo() (*cloudprovider.MachineInfo, error) {
+	return &cloudprovider.MachineInfo{InstanceID: string(provider.name)}, nil
+}
+
+// Blocks in InitContext until its context is cancelled
+type blockingProvider struct {
+	fakeProvider
+	cancelled chan error
+}
+
+func (provider *blockingProvider) InitContext(ctx context.Context) error {
+	<-ctx.Done()
+	provider.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func (provider *blockingProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	return provider.GetMachineInfo()
+}
+
+var errNotHere = errors.New("not here")
+
+func TestProbeHonorsPriority(t *testing.T) {
+	providers := []cloudprovider.ICloudProviderVirtualMachine{
+		&fakeProvider{name: "first", delay: 20 * time.Millisecond, err: errNotHere},
+		&fakeProvider{name: "second", delay: 50 * time.Millisecond},
+		&fakeProvider{name: "third", delay: time.Millisecond},
+	}
+	opts := service_provider_factory.ProbeOptions{Deadline: time.Second, ProviderTimeout: time.Second}
+
+	chosen, results := service_provider_factory.ProbeServiceProviders(providers, opts)
+	if chosen == nil || chosen.GetName() != "second" {
+		t.Fatalf("chosen = %v, want second", chosen)
+	}
+	if len(results) != 3 || results[0].Err != errNotHere || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if results[1].Duration < 50*time.Millisecond {
+		t.Errorf("second took %v, expected at least its Init delay", results[1].Duration)
+	}
+}
+
+func TestProbeTimeouts(t *testing.T) {
+	providers := []cloudprovider.ICloudProviderVirtualMachine{
+		&fakeProvider{name: "hanging", delay: time.Hour},
+		&fakeProvider{name: "slow", delay: 200 * time.Millisecond},
+		&fakeProvider{name: "fast", delay: time.Millisecond},
+	}
+
+	start := time.Now()
+	opts := service_provider_factory.ProbeOptions{Deadline: time.Second, ProviderTimeout: 50 * time.Millisecond}
+	chosen, results := service_provider_factory.ProbeServiceProviders(providers, opts)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("probing took %v despite the provider timeout", elapsed)
+	}
+	if chosen == nil || chosen.GetName() != "fast" {
+		t.Fatalf("chosen = %v, want fast", chosen)
+	}
+	if results[0].Err == nil || results[1].Err == nil {
+		t.Errorf("timed out providers reported success: %v", results)
+	}
+	if !errors.Is(results[0].Err, service_provider_factory.ErrProbeTimeout) || errors.Is(results[0].Err, cloudprovider.ErrTimeout) {
+		t.Errorf("hanging provider failed with %v, want a probe timeout", results[0].Err)
+	}
+
+	opts = service_provider_factory.ProbeOptions{Deadline: 50 * time.Millisecond, ProviderTimeout: time.Second}
+	chosen, _ = service_provider_factory.ProbeServiceProviders(providers[:2], opts)
+	if chosen != nil {
+		t.Errorf("chosen = %v after the global deadline, want none", chosen.GetName())
+	}
+}
+
+func TestProbeZeroOptions(t *testing.T) {
+	providers := []cloudprovider.ICloudProviderVirtualMachine{&fakeProvider{name: "local", delay: 10 * time.Millisecond}}
+	chosen, results := service_provider_factory.ProbeServiceProviders(providers, service_provider_factory.ProbeOptions{})
+	if chosen == nil || results[0].Err != nil {
+		t.Fatalf("zero options failed the probe: %v", results[0].Err)
+	}
+}
+
+func TestProbeCancellation(t *testing.T) {
+	provider := &blockingProvider{fakeProvider: fakeProvider{name: "blocking"}, cancelled: make(chan error, 1)}
+	providers := []cloudprovider.ICloudProviderVirtualMachine{provider}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	opts := service_provider_factory.ProbeOptions{Deadline: time.Minute, ProviderTimeout: time.Minute}
+	chosen, results := service_provider_factory.ProbeServiceProvidersContext(ctx, providers, opts)
+	if chosen != nil {
+		t.Fatalf("chosen = %v, want none", chosen.GetName())
+	}
+	if !errors.Is(results[0].Err, context.Canceled) {
+		t.Errorf("result error = %v, want context.Canceled", results[0].Err)
+	}
+	select {
+	case err := <-provider.cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("InitContext saw %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("cancellation did not reach InitContext")
+	}
+}
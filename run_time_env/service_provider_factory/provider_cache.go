@@ -0,0 +1,273 @@
+package service_provider_factory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+type CacheOptions struct {
+	Probe             ProbeOptions  // zero durations are taken from DefaultProbeOptions
+	MachineInfoTTL    time.Duration // 0 keeps MachineInfo until Reset/Refresh
+	FailureBackoff    time.Duration // first wait before detection is retried after a failure
+	MaxFailureBackoff time.Duration // the wait doubles after every consecutive failure up to this
+}
+
+var DefaultCacheOptions = CacheOptions{
+	Probe:             DefaultProbeOptions,
+	MachineInfoTTL:    5 * time.Minute,
+	FailureBackoff:    5 * time.Second,
+	MaxFailureBackoff: 5 * time.Minute,
+}
+
+var ErrDetectionBackoff = errors.New("provider detection recently failed, retry is delayed")
+
+// Concurrency safe detected provider. Concurrent callers share a single detection,
+// failures are retried only after a growing backoff, and MachineInfo is refreshed after its TTL.
+type ProviderCache struct {
+	opts CacheOptions
+
+	mutex      sync.Mutex
+	generation int // incremented by reset, calls started before it discard their results
+	provider   cloudprovider.ICloudProviderVirtualMachine
+	report     *DetectionReport
+	err        error
+	retryAt    time.Time
+	backoff    time.Duration
+	detecting  *cacheCall
+
+	info       *cloudprovider.MachineInfo
+	infoExpiry time.Time
+	fetching   *cacheCall
+}
+
+// An in-flight detection or MachineInfo lookup that later callers wait for
+type cacheCall struct {
+	done      chan struct{}
+	provider  cloudprovider.ICloudProviderVirtualMachine
+	info      *cloudprovider.MachineInfo
+	err       error
+	cancelled bool // the caller running it gave up, err is its context error
+}
+
+func NewProviderCache(opts CacheOptions) *ProviderCache {
+	opts.Probe = opts.Probe.withDefaults()
+	return &ProviderCache{opts: opts}
+}
+
+// Returns the detected provider, detecting it on first use
+func (cache *ProviderCache) GetProvider(ctx context.Context) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	cache.mutex.Lock()
+	if cache.provider != nil {
+		defer cache.mutex.Unlock()
+		return cache.provider, nil
+	}
+	if cache.detecting == nil && cache.err != nil && time.Now().Before(cache.retryAt) {
+		defer cache.mutex.Unlock()
+		return nil, fmt.Errorf("%w (until %v): %w", ErrDetectionBackoff, cache.retryAt.Format(time.RFC3339), cache.err)
+	}
+	return cache.detect(ctx)
+}
+
+// Replaces the options and forgets the detected provider
+func (cache *ProviderCache) Configure(opts CacheOptions) {
+	cache.mutex.Lock()
+	opts.Probe = opts.Probe.withDefaults()
+	cache.opts = opts
+	cache.mutex.Unlock()
+	cache.Reset()
+}
+
+// Forgets the detected provider, its MachineInfo and any failure backoff.
+// Detections and lookups in flight still answer their callers but are not cached
+func (cache *ProviderCache) Reset() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.reset()
+}
+
+// Detects the provider again right away, ignoring the failure backoff.
+// A detection already in flight is waited for, never returned in place of the new one
+func (cache *ProviderCache) Refresh(ctx context.Context) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	for {
+		cache.mutex.Lock()
+		call := cache.detecting
+		if call == nil {
+			cache.reset()
+			return cache.detect(ctx)
+		}
+		cache.mutex.Unlock()
+		if err := call.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// The report of the last completed detection, nil before the first one
+func (cache *ProviderCache) Report() *DetectionReport {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.report
+}
+
+// Returns the provider's MachineInfo. Once the TTL has passed a new instance of the provider is
+// initialized and replaces the detected one, see fetchMachineInfo.
+// When that fails the last MachineInfo is returned along with the error
+func (cache *ProviderCache) GetMachineInfo(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	provider, err := cache.GetProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		cache.mutex.Lock()
+		if cache.info != nil && (cache.opts.MachineInfoTTL == 0 || time.Now().Before(cache.infoExpiry)) {
+			defer cache.mutex.Unlock()
+			return cache.info, nil
+		}
+		call := cache.fetching
+		if call == nil {
+			call = &cacheCall{done: make(chan struct{})}
+			cache.fetching = call
+			stale := cache.info
+			generation := cache.generation
+			cache.mutex.Unlock()
+
+			call.provider, call.info, call.err = fetchMachineInfo(ctx, provider, stale != nil)
+			call.cancelled = ctx.Err() != nil
+
+			cache.mutex.Lock()
+			if cache.fetching == call {
+				cache.fetching = nil
+			}
+			if call.err != nil {
+				call.info = stale
+			} else if cache.generation == generation && cache.provider == provider {
+				cache.provider = call.provider
+				cache.info = call.info
+				cache.infoExpiry = time.Now().Add(cache.opts.MachineInfoTTL)
+			}
+			cache.mutex.Unlock()
+			close(call.done)
+			return call.info, call.err
+		}
+		cache.mutex.Unlock()
+		if err := call.wait(ctx); err != nil {
+			return nil, err
+		}
+		if !call.cancelled {
+			return call.info, call.err
+		}
+		// the caller that ran the lookup gave up, which says nothing about this one
+	}
+}
+
+// Must be called with the mutex held
+func (cache *ProviderCache) reset() {
+	cache.generation++
+	cache.detecting = nil
+	cache.fetching = nil
+	cache.provider = nil
+	cache.report = nil
+	cache.err = nil
+	cache.retryAt = time.Time{}
+	cache.backoff = 0
+	cache.info = nil
+	cache.infoExpiry = time.Time{}
+}
+
+// Must be called with the mutex held, releases it
+func (cache *ProviderCache) detect(ctx context.Context) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	call := cache.detecting
+	if call != nil {
+		cache.mutex.Unlock()
+		if err := call.wait(ctx); err != nil {
+			return nil, err
+		}
+		if call.cancelled {
+			// the caller that ran the detection gave up, which says nothing about this one
+			return cache.GetProvider(ctx)
+		}
+		return call.provider, call.err
+	}
+
+	call = &cacheCall{done: make(chan struct{})}
+	cache.detecting = call
+	probeOpts := cache.opts.Probe
+	generation := cache.generation
+	cache.mutex.Unlock()
+
+	report := DetectServiceProviderContext(ctx, probeOpts)
+	call.provider, call.err = report.Provider, report.Err
+	call.cancelled = call.err != nil && ctx.Err() != nil
+
+	cache.mutex.Lock()
+	if cache.detecting == call {
+		cache.detecting = nil
+	}
+	// Reset was called meanwhile
+	stale := cache.generation != generation
+	if !stale {
+		cache.report = report
+	}
+	switch {
+	case stale:
+	case call.err == nil:
+		cache.provider = call.provider
+		cache.err = nil
+		cache.backoff = 0
+	case call.cancelled:
+		// the caller gave up, that says nothing about the environment
+	default:
+		cache.err = call.err
+		if cache.backoff == 0 {
+			cache.backoff = cache.opts.FailureBackoff
+		} else if cache.backoff *= 2; cache.backoff > cache.opts.MaxFailureBackoff {
+			cache.backoff = cache.opts.MaxFailureBackoff
+		}
+		cache.retryAt = time.Now().Add(cache.backoff)
+	}
+	cache.mutex.Unlock()
+	close(call.done)
+	return call.provider, call.err
+}
+
+func (call *cacheCall) wait(ctx context.Context) error {
+	select {
+	case <-call.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Providers collect MachineInfo in Init, so a refresh initializes a new instance from the registry
+// and returns it. Callers, lifecycle subscriptions and attesters holding the old instance keep it
+// unchanged, an instance is never initialized again while it is shared
+func fetchMachineInfo(ctx context.Context, provider cloudprovider.ICloudProviderVirtualMachine, refresh bool) (cloudprovider.ICloudProviderVirtualMachine, *cloudprovider.MachineInfo, error) {
+	if refresh {
+		fresh, err := newServiceProvider(provider.GetName())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = cloudprovider.InitContext(ctx, fresh); err != nil {
+			return nil, nil, err
+		}
+		provider = fresh
+	}
+	info, err := cloudprovider.GetMachineInfoContext(ctx, provider)
+	return provider, info, err
+}
+
+func newServiceProvider(name cloudprovider.CloudProviderType) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	for _, p := range cloudprovider.RegisteredProviders() {
+		if p.Name == name && p.Constructor != nil {
+			return p.Constructor(), nil
+		}
+	}
+	return nil, fmt.Errorf("%v: %w", name, cloudprovider.ErrUnimplemented)
+}
@@ -0,0 +1,315 @@
+package service_provider_factory_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/service_provider_factory"
+)
+
+type countingProvider struct {
+	fakeProvider
+	inits *int32
+}
+
+func (provider *countingProvider) Init() error {
+	atomic.AddInt32(provider.inits, 1)
+	return provider.fakeProvider.Init()
+}
+
+// Registers a provider that is the only detection candidate of the returned options
+func newCountingCache(t *testing.T, name cloudprovider.CloudProviderType, err error, opts service_provider_factory.CacheOptions) (*service_provider_factory.ProviderCache, *int32, *int32) {
+	var inits, instances int32
+	cloudprovider.Register(name, func() cloudprovider.ICloudProviderVirtualMachine {
+		atomic.AddInt32(&instances, 1)
+		return &countingProvider{fakeProvider: fakeProvider{name: name, delay: 20 * time.Millisecond, err: err}, inits: &inits}
+	}, -1)
+	t.Cleanup(func() { cloudprovider.Unregister(name) })
+
+	opts.Probe = service_provider_factory.ProbeOptions{
+		Deadline:        time.Second,
+		ProviderTimeout: time.Second,
+		Candidates:      []cloudprovider.CloudProviderType{name},
+	}
+	return service_provider_factory.NewProviderCache(opts), &inits, &instances
+}
+
+func TestProviderCacheSingleDetection(t *testing.T) {
+	cache, inits, _ := newCountingCache(t, "TestCached", nil, service_provider_factory.DefaultCacheOptions)
+
+	var wg sync.WaitGroup
+	providers := make([]cloudprovider.ICloudProviderVirtualMachine, 20)
+	for i := range providers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			providers[i], _ = cache.GetProvider(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(inits); n != 1 {
+		t.Errorf("concurrent first calls initialized %v providers", n)
+	}
+	for i := range providers {
+		if providers[i] == nil || providers[i] != providers[0] {
+			t.Fatalf("caller %v got a different provider", i)
+		}
+	}
+
+	if _, err := cache.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(inits); n != 2 {
+		t.Errorf("Refresh did not detect again, %v Init calls", n)
+	}
+}
+
+func TestProviderCacheFailureBackoff(t *testing.T) {
+	opts := service_provider_factory.DefaultCacheOptions
+	opts.FailureBackoff = 100 * time.Millisecond
+	opts.MaxFailureBackoff = time.Second
+	cache, inits, _ := newCountingCache(t, "TestUnavailable", errNotHere, opts)
+
+	if _, err := cache.GetProvider(context.Background()); err == nil || errors.Is(err, service_provider_factory.ErrDetectionBackoff) {
+		t.Fatalf("first detection returned %v", err)
+	}
+	if _, err := cache.GetProvider(context.Background()); !errors.Is(err, service_provider_factory.ErrDetectionBackoff) {
+		t.Fatalf("detection during backoff returned %v", err)
+	}
+	if n := atomic.LoadInt32(inits); n != 1 {
+		t.Errorf("detection was retried during the backoff, %v Init calls", n)
+	}
+
+	time.Sleep(opts.FailureBackoff)
+	cache.GetProvider(context.Background())
+	if n := atomic.LoadInt32(inits); n != 2 {
+		t.Errorf("detection was not retried after the backoff, %v Init calls", n)
+	}
+
+	cache.Reset()
+	cache.GetProvider(context.Background())
+	if n := atomic.LoadInt32(inits); n != 3 {
+		t.Errorf("Reset did not clear the backoff, %v Init calls", n)
+	}
+}
+
+func TestProviderCacheMachineInfoTTL(t *testing.T) {
+	opts := service_provider_factory.DefaultCacheOptions
+	opts.MachineInfoTTL = 100 * time.Millisecond
+	cache, inits, instances := newCountingCache(t, "TestTTL", nil, opts)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.GetMachineInfo(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(instances); n != 1 {
+		t.Errorf("MachineInfo was refreshed within its TTL, %v instances", n)
+	}
+
+	time.Sleep(opts.MachineInfoTTL)
+	if _, err := cache.GetMachineInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(inits); n != 2 {
+		t.Errorf("MachineInfo was not refreshed after its TTL, %v Init calls", n)
+	}
+	if n := atomic.LoadInt32(instances); n != 2 {
+		t.Errorf("the refresh initialized the shared instance again, %v instances", n)
+	}
+}
+
+// InitContext writes the state that GetMachineInfoContext and WatchLifecycleEvents read
+type statefulProvider struct {
+	fakeProvider
+	info *cloudprovider.MachineInfo
+}
+
+func (provider *statefulProvider) InitContext(ctx context.Context) error {
+	provider.info = &cloudprovider.MachineInfo{InstanceID: string(provider.name)}
+	return nil
+}
+
+func (provider *statefulProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	return provider.info, nil
+}
+
+func (provider *statefulProvider) WatchLifecycleEvents(ctx context.Context, handler cloudprovider.LifecycleEventHandler) error {
+	for ctx.Err() == nil {
+		if provider.info == nil {
+			return errNotHere
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return ctx.Err()
+}
+
+// Meaningful with -race: a refresh must not write to the instance that is in use
+func TestProviderCacheRefreshWhileInUse(t *testing.T) {
+	name := cloudprovider.CloudProviderType("TestInUse")
+	cloudprovider.Register(name, func() cloudprovider.ICloudProviderVirtualMachine {
+		return &statefulProvider{fakeProvider: fakeProvider{name: name}}
+	}, -1)
+	t.Cleanup(func() { cloudprovider.Unregister(name) })
+	opts := service_provider_factory.DefaultCacheOptions
+	opts.MachineInfoTTL = time.Millisecond
+	opts.Probe = service_provider_factory.ProbeOptions{Candidates: []cloudprovider.CloudProviderType{name}}
+	cache := service_provider_factory.NewProviderCache(opts)
+
+	provider, err := cache.GetProvider(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription, err := service_provider_factory.SubscribeProvider(context.Background(), provider, func(*cloudprovider.LifecycleEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			cloudprovider.GetMachineInfoContext(context.Background(), provider)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := cache.GetMachineInfo(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+	if err = subscription.Close(); err != nil {
+		t.Error(err)
+	}
+	if current, _ := cache.GetProvider(context.Background()); current == provider {
+		t.Error("the refreshed instance did not replace the detected one")
+	}
+}
+
+// Init fails once failing is set, GetMachineInfoContext waits for delay or its context
+type flakyProvider struct {
+	fakeProvider
+	failing *atomic.Bool
+}
+
+func (provider *flakyProvider) InitContext(ctx context.Context) error {
+	if provider.failing.Load() {
+		return errNotHere
+	}
+	return nil
+}
+
+func (provider *flakyProvider) GetMachineInfoContext(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	select {
+	case <-time.After(provider.delay):
+		return provider.GetMachineInfo()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newFlakyCache(t *testing.T, name cloudprovider.CloudProviderType, delay time.Duration, opts service_provider_factory.CacheOptions) (*service_provider_factory.ProviderCache, *atomic.Bool) {
+	failing := &atomic.Bool{}
+	cloudprovider.Register(name, func() cloudprovider.ICloudProviderVirtualMachine {
+		return &flakyProvider{fakeProvider: fakeProvider{name: name, delay: delay}, failing: failing}
+	}, -1)
+	t.Cleanup(func() { cloudprovider.Unregister(name) })
+	opts.Probe = service_provider_factory.ProbeOptions{Deadline: time.Second, ProviderTimeout: time.Second, Candidates: []cloudprovider.CloudProviderType{name}}
+	return service_provider_factory.NewProviderCache(opts), failing
+}
+
+func TestProviderCacheStaleMachineInfo(t *testing.T) {
+	opts := service_provider_factory.DefaultCacheOptions
+	opts.MachineInfoTTL = 50 * time.Millisecond
+	cache, failing := newFlakyCache(t, "TestStale", time.Millisecond, opts)
+
+	info, err := cache.GetMachineInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(opts.MachineInfoTTL)
+	failing.Store(true)
+	stale, err := cache.GetMachineInfo(context.Background())
+	if !errors.Is(err, errNotHere) || stale != info {
+		t.Errorf("failed refresh = %v, %v, want the last MachineInfo and the error", stale, err)
+	}
+	failing.Store(false)
+	if _, err = cache.GetMachineInfo(context.Background()); err != nil {
+		t.Errorf("refresh after the failure: %v", err)
+	}
+}
+
+func TestProviderCacheCancelledLookup(t *testing.T) {
+	cache, _ := newFlakyCache(t, "TestCancelled", 100*time.Millisecond, service_provider_factory.DefaultCacheOptions)
+	if _, err := cache.GetProvider(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	leader := make(chan error)
+	go func() {
+		_, err := cache.GetMachineInfo(ctx)
+		leader <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if info, err := cache.GetMachineInfo(context.Background()); err != nil || info == nil {
+		t.Errorf("waiter got %v, %v, want its own lookup after the leader gave up", info, err)
+	}
+	if err := <-leader; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("leader got %v", err)
+	}
+}
+
+func TestProviderCacheRefreshDuringDetection(t *testing.T) {
+	cache, inits, _ := newCountingCache(t, "TestRefreshing", nil, service_provider_factory.DefaultCacheOptions)
+	detected := make(chan struct{})
+	go func() {
+		cache.GetProvider(context.Background())
+		close(detected)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	if _, err := cache.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-detected
+	if n := atomic.LoadInt32(inits); n != 2 {
+		t.Errorf("Refresh joined the detection in flight, %v Init calls", n)
+	}
+}
+
+func TestProviderCacheResetDuringDetection(t *testing.T) {
+	cache, inits, _ := newCountingCache(t, "TestResetting", nil, service_provider_factory.DefaultCacheOptions)
+	detected := make(chan struct{})
+	go func() {
+		cache.GetProvider(context.Background())
+		close(detected)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cache.Reset()
+	<-detected
+	if report := cache.Report(); report != nil {
+		t.Errorf("the detection started before Reset was cached:\n%v", report.ToText())
+	}
+	if _, err := cache.GetProvider(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(inits); n != 2 {
+		t.Errorf("%v Init calls, want a new detection after Reset", n)
+	}
+}
+
+func TestProviderCacheZeroProbeOptions(t *testing.T) {
+	cache, _, _ := newCountingCache(t, "TestZeroProbe", nil, service_provider_factory.CacheOptions{})
+	cache.Configure(service_provider_factory.CacheOptions{Probe: service_provider_factory.ProbeOptions{Candidates: []cloudprovider.CloudProviderType{"TestZeroProbe"}}})
+	if _, err := cache.GetProvider(context.Background()); err != nil {
+		t.Errorf("detection with zero probe durations: %v", err)
+	}
+}
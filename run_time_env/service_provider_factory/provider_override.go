@@ -0,0 +1,78 @@
+package service_provider_factory
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+)
+
+const (
+	// Forces a provider by its CloudProviderType, e.g. VLZ_CLOUD_PROVIDER=AWS
+	cloudProviderKey = "VLZ_CLOUD_PROVIDER"
+	// Restricts detection to a comma separated list, e.g. VLZ_CLOUD_PROVIDER_CANDIDATES=OnPrem/Config,AWS
+	cloudProviderCandidatesKey = "VLZ_CLOUD_PROVIDER_CANDIDATES"
+)
+
+// Fills Provider and Candidates from the environment and the durations from DefaultProbeOptions
+// unless already set, and validates them
+func (opts ProbeOptions) resolve() (ProbeOptions, error) {
+	opts = opts.withDefaults()
+	if opts.Provider == "" {
+		opts.Provider = cloudprovider.CloudProviderType(strings.TrimSpace(os.Getenv(cloudProviderKey)))
+	}
+	if len(opts.Candidates) == 0 {
+		for _, name := range strings.Split(os.Getenv(cloudProviderCandidatesKey), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.Candidates = append(opts.Candidates, cloudprovider.CloudProviderType(name))
+			}
+		}
+	}
+
+	if opts.Provider != "" {
+		if _, err := cloudprovider.ConvertToCloudProviderType(string(opts.Provider)); err != nil {
+			return opts, fmt.Errorf("%v: %w", cloudProviderKey, err)
+		}
+		if len(opts.Candidates) > 0 && !containsProvider(opts.Candidates, opts.Provider) {
+			return opts, fmt.Errorf("forced provider %v is not one of the candidates %v: %w", opts.Provider, opts.Candidates, cloudprovider.ErrInvalidConfig)
+		}
+	}
+	for _, name := range opts.Candidates {
+		if _, err := cloudprovider.ConvertToCloudProviderType(string(name)); err != nil {
+			return opts, fmt.Errorf("%v: %w", cloudProviderCandidatesKey, err)
+		}
+	}
+	return opts, nil
+}
+
+// Returns the providers detection should probe, in probing order.
+// A forced provider is used even if it is disabled in the registry.
+func selectServiceProviders(opts ProbeOptions) ([]cloudprovider.ICloudProviderVirtualMachine, error) {
+	list := []cloudprovider.ICloudProviderVirtualMachine{}
+	for _, p := range cloudprovider.RegisteredProviders() {
+		if opts.Provider != "" {
+			if p.Name != opts.Provider {
+				continue
+			}
+			if p.Constructor == nil {
+				return nil, fmt.Errorf("forced provider %v: %w", p.Name, cloudprovider.ErrUnimplemented)
+			}
+		} else if p.Disabled || p.Constructor == nil {
+			continue
+		} else if len(opts.Candidates) > 0 && !containsProvider(opts.Candidates, p.Name) {
+			continue
+		}
+		list = append(list, p.Constructor())
+	}
+	return list, nil
+}
+
+func containsProvider(list []cloudprovider.CloudProviderType, name cloudprovider.CloudProviderType) bool {
+	for _, p := range list {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package service_provider_factory_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/service_provider_factory"
+)
+
+func registerFakeProviders(t *testing.T) {
+	fakes := []*fakeProvider{
+		{name: "TestFirst"},
+		{name: "TestBroken", err: errNotHere},
+		{name: "TestLast"},
+	}
+	for i, fake := range fakes {
+		fake := fake
+		cloudprovider.Register(fake.name, func() cloudprovider.ICloudProviderVirtualMachine { return fake }, -100+i)
+		t.Cleanup(func() { cloudprovider.Unregister(fake.name) })
+	}
+}
+
+func TestProviderOverride(t *testing.T) {
+	registerFakeProviders(t)
+	opts := service_provider_factory.ProbeOptions{Deadline: time.Second, ProviderTimeout: time.Second}
+
+	report := service_provider_factory.DetectServiceProvider(opts)
+	if report.ChosenName() != "TestFirst" {
+		t.Fatalf("detection without override chose %v", report.ChosenName())
+	}
+
+	opts.Provider = "TestLast"
+	report = service_provider_factory.DetectServiceProvider(opts)
+	if report.ChosenName() != "TestLast" || len(report.Attempts) != 1 || report.Err != nil {
+		t.Fatalf("forced provider was not used:\n%v", report.ToText())
+	}
+
+	opts.Provider = "TestBroken"
+	report = service_provider_factory.DetectServiceProvider(opts)
+	if report.Provider != nil || !errors.Is(report.Err, errNotHere) {
+		t.Fatalf("forced provider failure did not fail detection:\n%v", report.ToText())
+	}
+
+	opts.Provider = "NoSuchCloud"
+	if report = service_provider_factory.DetectServiceProvider(opts); report.Err == nil || len(report.Attempts) != 0 {
+		t.Fatalf("unknown forced provider was accepted:\n%v", report.ToText())
+	}
+}
+
+func TestProviderOverrideOnly(t *testing.T) {
+	registerFakeProviders(t)
+	report := service_provider_factory.DetectServiceProvider(service_provider_factory.ProbeOptions{Provider: "TestLast"})
+	if report.ChosenName() != "TestLast" || report.Err != nil {
+		t.Fatalf("forcing a provider without durations failed:\n%v", report.ToText())
+	}
+}
+
+func TestProviderCandidatesFromEnv(t *testing.T) {
+	registerFakeProviders(t)
+	opts := service_provider_factory.ProbeOptions{Deadline: time.Second, ProviderTimeout: time.Second}
+
+	t.Setenv("VLZ_CLOUD_PROVIDER_CANDIDATES", "TestLast, TestBroken")
+	report := service_provider_factory.DetectServiceProvider(opts)
+	if report.ChosenName() != "TestLast" || len(report.Attempts) != 2 || report.Attempts[0].Name != "TestBroken" {
+		t.Fatalf("candidates were not restricted:\n%v", report.ToText())
+	}
+
+	t.Setenv("VLZ_CLOUD_PROVIDER", "TestFirst")
+	if report = service_provider_factory.DetectServiceProvider(opts); report.Err == nil {
+		t.Fatalf("forced provider outside the candidates was accepted:\n%v", report.ToText())
+	}
+
+	opts.Candidates = []cloudprovider.CloudProviderType{"TestFirst"}
+	if report = service_provider_factory.DetectServiceProvider(opts); report.ChosenName() != "TestFirst" {
+		t.Fatalf("explicit candidates did not take precedence over the environment:\n%v", report.ToText())
+	}
+}
@@ -1,21 +1,31 @@
 package service_provider_factory
 
 import (
+	"context"
+
 	"github.com/VolumezTech/volumez-cloud-provider/cloudprovider"
 	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/amz"
 	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/azure"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/gcp"
+	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/oci"
 	"github.com/VolumezTech/volumez-cloud-provider/run_time_env/on_prem"
 )
 
-var s_Provider cloudprovider.ICloudProviderVirtualMachine
+var s_Cache = NewProviderCache(DefaultCacheOptions)
+
+func init() {
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_OnPremEnv, on_prem.NewOnPremEnvServiceProvider)
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_OnPremConfig, newConfigProvider)
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_Aws, amz.NewAmzServiceProvider)
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_Azure, azure.NewAzureServiceProvider)
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_Gcp, gcp.NewGcpServiceProvider)
+	cloudprovider.RegisterDefaultConstructor(cloudprovider.CloudProvider_Oci, oci.NewOciServiceProvider)
+}
 
+// Returns a new instance of every enabled provider in the registry, in probing order.
+// Use cloudprovider.Register, SetPriority and Disable to add, reorder or disable providers
 func GetSupportedServiceProviders() []cloudprovider.ICloudProviderVirtualMachine {
-	constructors := []cloudprovider.ServiceProviderConstructor{
-		on_prem.NewOnPremEnvServiceProvider,
-		newConfigProvider,
-		amz.NewAmzServiceProvider,
-		azure.NewAzureServiceProvider,
-	}
+	constructors := cloudprovider.GetRegisteredConstructors()
 	list := make([]cloudprovider.ICloudProviderVirtualMachine, 0, len(constructors))
 	for i := range constructors {
 		provider := constructors[i]()
@@ -26,21 +36,49 @@ func GetSupportedServiceProviders() []cloudprovider.ICloudProviderVirtualMachine
 
 // Returns the first provider that was successfully initialized
 func GetServiceProvider() cloudprovider.ICloudProviderVirtualMachine {
+	return GetServiceProviderContext(context.Background())
+}
 
-	if s_Provider == nil {
-		providers := GetSupportedServiceProviders()
-		for i := range providers {
-			provider := providers[i]
-			if provider != nil {
-				err := provider.Init()
-				if err == nil {
-					s_Provider = provider
-					break
-				}
-			}
-		}
+func GetServiceProviderContext(ctx context.Context) cloudprovider.ICloudProviderVirtualMachine {
+	provider, _ := s_Cache.GetProvider(ctx)
+	return provider
+}
+
+// Same as GetServiceProviderContext, also returning why no provider is available
+func LookupServiceProvider(ctx context.Context) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	return s_Cache.GetProvider(ctx)
+}
+
+// MachineInfo of the detected provider, refreshed once CacheOptions.MachineInfoTTL has passed
+func GetMachineInfo(ctx context.Context) (*cloudprovider.MachineInfo, error) {
+	return s_Cache.GetMachineInfo(ctx)
+}
+
+// Proves the identity of the detected provider's machine for nonce, see cloudprovider.Attest
+func Attest(ctx context.Context, nonce string) (*cloudprovider.AttestationBundle, error) {
+	provider, err := LookupServiceProvider(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return s_Provider
+	return cloudprovider.Attest(ctx, provider, nonce)
+}
+
+// Reconfigures the package cache, dropping the detected provider
+func ConfigureCache(opts CacheOptions) {
+	s_Cache.Configure(opts)
+}
+
+func ResetServiceProvider() {
+	s_Cache.Reset()
+}
+
+func RefreshServiceProvider(ctx context.Context) (cloudprovider.ICloudProviderVirtualMachine, error) {
+	return s_Cache.Refresh(ctx)
+}
+
+// The report of the package cache's last detection, nil before the first one
+func GetDetectionReport() *DetectionReport {
+	return s_Cache.Report()
 }
 
 func newConfigProvider() cloudprovider.ICloudProviderVirtualMachine {
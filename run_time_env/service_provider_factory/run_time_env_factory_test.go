@@ -9,28 +9,19 @@ import (
 
 func TestRunTimeEnv(t *testing.T) {
 
-	providers := service_provider_factory.GetSupportedServiceProviders()
-	for i := range providers {
-		provider := providers[i]
-		if provider != nil {
-			fmt.Printf("===== Trying Provider=%v... ", provider.GetName())
-			err := provider.Init()
-			msg := "OK\n"
-			if err != nil {
-				msg = fmt.Sprintf("FAILED\nerr=%v\n-----------------------\n", err)
-			}
-			fmt.Print(msg)
-			if err == nil {
-				break
-			}
-		}
-	}
+	opts := service_provider_factory.DefaultProbeOptions
+	opts.WaitForAll = true
+	report := service_provider_factory.DetectServiceProvider(opts)
+	fmt.Println(report.ToText())
 
 	provider := service_provider_factory.GetServiceProvider()
 
 	if provider == nil {
 		panic("Unsupported env")
 	}
+	if provider.GetName() != report.ChosenName() {
+		panic(fmt.Sprintf("GetServiceProvider chose %v, detection report chose %v", provider.GetName(), report.ChosenName()))
+	}
 	info, err := provider.GetMachineInfo()
 	if err != nil {
 		fmt.Print(err)
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The address family of the IMDS endpoint
+type EndpointMode string
+
+const (
+	EndpointModeAuto EndpointMode = ""     // IPv4, or IPv6 when IPv4 does not answer
+	EndpointModeIPv4 EndpointMode = "IPv4" // DefaultIMDSEndpoint
+	EndpointModeIPv6 EndpointMode = "IPv6" // DefaultIMDSEndpointIPv6, e.g. on IPv6 only Nitro instances
+)
+
+// Endpoints are a scheme and a host with an optional port, the provider's path is appended to them.
+// The environment variables override the defaults, options given in code override both
+const (
+	DefaultIMDSEndpointIPv6 = "http://[fd00:ec2::254]"
+	// Same names and meaning as in the AWS SDKs, e.g. AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE=IPv6
+	IMDSEndpointEnv     = "AWS_EC2_METADATA_SERVICE_ENDPOINT"
+	IMDSEndpointModeEnv = "AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE"
+
+	DefaultAzureMetadataEndpoint = "http://169.254.169.254"
+	AzureMetadataEndpointEnv     = "VLZ_AZURE_METADATA_ENDPOINT"
+
+	DefaultGCEMetadataEndpoint = "http://metadata.google.internal"
+	// A host[:port] without scheme, as the Google client libraries read it
+	GCEMetadataHostEnv = "GCE_METADATA_HOST"
+
+	DefaultOCIMetadataEndpoint = "http://169.254.169.254"
+	OCIMetadataEndpointEnv     = "VLZ_OCI_METADATA_ENDPOINT"
+)
+
+// Options of the Azure, GCP and OCI metadata clients
+type MetadataClientOptions struct {
+	Endpoint string       // scheme and host of the metadata server, the provider's default if empty
+	Retry    *RetryPolicy // MetadataRetryPolicy if nil
+}
+
+// Case insensitive, "" is EndpointModeAuto
+func ParseEndpointMode(s string) (EndpointMode, error) {
+	switch mode := EndpointMode(strings.TrimSpace(s)); {
+	case mode == EndpointModeAuto:
+		return EndpointModeAuto, nil
+	case strings.EqualFold(string(mode), string(EndpointModeIPv4)):
+		return EndpointModeIPv4, nil
+	case strings.EqualFold(string(mode), string(EndpointModeIPv6)):
+		return EndpointModeIPv6, nil
+	}
+	return "", fmt.Errorf("%w: endpoint mode %q, want %v or %v", ErrInvalidConfig, s, EndpointModeIPv4, EndpointModeIPv6)
+}
+
+// The IMDS endpoints to try in order. An endpoint, given or from IMDSEndpointEnv if mode is EndpointModeAuto,
+// is used as is, otherwise mode, or IMDSEndpointModeEnv if mode is EndpointModeAuto, selects the address family
+func IMDSEndpoints(endpoint string, mode EndpointMode) ([]string, error) {
+	if endpoint == "" && mode == EndpointModeAuto {
+		endpoint = os.Getenv(IMDSEndpointEnv)
+	}
+	if endpoint = normalizeEndpoint(endpoint); endpoint != "" {
+		return []string{endpoint}, nil
+	}
+	if mode == EndpointModeAuto {
+		var err error
+		if mode, err = ParseEndpointMode(os.Getenv(IMDSEndpointModeEnv)); err != nil {
+			return nil, fmt.Errorf("%v: %w", IMDSEndpointModeEnv, err)
+		}
+	}
+	switch mode {
+	case EndpointModeAuto:
+		return []string{DefaultIMDSEndpoint, DefaultIMDSEndpointIPv6}, nil
+	case EndpointModeIPv4:
+		return []string{DefaultIMDSEndpoint}, nil
+	case EndpointModeIPv6:
+		return []string{DefaultIMDSEndpointIPv6}, nil
+	}
+	_, err := ParseEndpointMode(string(mode))
+	return nil, err
+}
+
+func AzureMetadataEndpoint() string {
+	return endpointFromEnv(AzureMetadataEndpointEnv, DefaultAzureMetadataEndpoint)
+}
+
+func GCEMetadataEndpoint() string {
+	return endpointFromEnv(GCEMetadataHostEnv, DefaultGCEMetadataEndpoint)
+}
+
+func OCIMetadataEndpoint() string {
+	return endpointFromEnv(OCIMetadataEndpointEnv, DefaultOCIMetadataEndpoint)
+}
+
+func endpointFromEnv(key string, fallback string) string {
+	if endpoint := normalizeEndpoint(os.Getenv(key)); endpoint != "" {
+		return endpoint
+	}
+	return fallback
+}
+
+// "169.254.169.254/" -> "http://169.254.169.254"
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return endpoint
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestIMDSEndpoints(t *testing.T) {
+	t.Setenv(IMDSEndpointEnv, "")
+	t.Setenv(IMDSEndpointModeEnv, "")
+	for _, test := range []struct {
+		endpoint string
+		mode     EndpointMode
+		env      map[string]string
+		want     []string
+	}{
+		{want: []string{DefaultIMDSEndpoint, DefaultIMDSEndpointIPv6}},
+		{mode: EndpointModeIPv6, want: []string{DefaultIMDSEndpointIPv6}},
+		{env: map[string]string{IMDSEndpointModeEnv: "ipv4"}, want: []string{DefaultIMDSEndpoint}},
+		{mode: EndpointModeIPv6, env: map[string]string{IMDSEndpointModeEnv: "IPv4"}, want: []string{DefaultIMDSEndpointIPv6}},
+		{env: map[string]string{IMDSEndpointEnv: "http://[fd00:ec2::254]/", IMDSEndpointModeEnv: "IPv4"}, want: []string{DefaultIMDSEndpointIPv6}},
+		{mode: EndpointModeIPv4, env: map[string]string{IMDSEndpointEnv: "http://localhost"}, want: []string{DefaultIMDSEndpoint}},
+		{endpoint: "127.0.0.1:8080", env: map[string]string{IMDSEndpointEnv: "http://localhost"}, want: []string{"http://127.0.0.1:8080"}},
+	} {
+		for key, value := range test.env {
+			t.Setenv(key, value)
+		}
+		if got, err := IMDSEndpoints(test.endpoint, test.mode); err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("IMDSEndpoints(%q, %q) with %v = %v, %v, want %v", test.endpoint, test.mode, test.env, got, err, test.want)
+		}
+		for key := range test.env {
+			t.Setenv(key, "")
+		}
+	}
+
+	t.Setenv(IMDSEndpointModeEnv, "dual")
+	if _, err := IMDSEndpoints("", EndpointModeAuto); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("invalid mode: %v", err)
+	}
+	if _, err := NewIMDSClient(IMDSClientOptions{}).Get(context.Background(), "meta-data/instance-id"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("client with an invalid mode: %v", err)
+	}
+}
+
+func TestEndpointFromEnv(t *testing.T) {
+	t.Setenv(GCEMetadataHostEnv, "")
+	if endpoint := GCEMetadataEndpoint(); endpoint != DefaultGCEMetadataEndpoint {
+		t.Errorf("GCEMetadataEndpoint() = %v", endpoint)
+	}
+	t.Setenv(GCEMetadataHostEnv, "metadata.example:8080")
+	if endpoint := GCEMetadataEndpoint(); endpoint != "http://metadata.example:8080" {
+		t.Errorf("GCEMetadataEndpoint() = %v", endpoint)
+	}
+}
+
+func TestIMDSClientSelectsEndpoint(t *testing.T) {
+	_, server := newTestIMDS(t, true)
+	// times out as an IPv4 endpoint does on an IPv6 only instance
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() }))
+	defer unreachable.Close()
+
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL})
+	client.endpoints = []string{unreachable.URL, server.URL}
+	if client.Endpoint() != unreachable.URL {
+		t.Errorf("Endpoint() = %v before the first request", client.Endpoint())
+	}
+	if id, err := client.GetMetadata(context.Background(), "instance-id"); err != nil || id != "i-0123456789abcdef0" {
+		t.Fatalf("GetMetadata() = %q, %v", id, err)
+	}
+	if client.Endpoint() != server.URL {
+		t.Errorf("Endpoint() = %v, want the endpoint that answered", client.Endpoint())
+	}
+
+	// the stand-in configured the way the AWS SDKs are
+	t.Setenv(IMDSEndpointEnv, server.URL)
+	if _, err := NewIMDSClient(IMDSClientOptions{}).GetMetadata(context.Background(), "instance-id"); err != nil {
+		t.Errorf("%v: %v", IMDSEndpointEnv, err)
+	}
+}
+
+func TestIMDSClientEndpointSelectionFails(t *testing.T) {
+	var probes atomic.Int32
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		<-r.Context().Done()
+	}))
+	defer unreachable.Close()
+	refused := httptest.NewServer(nil)
+	refused.Close()
+
+	// a refused connection is an answer, the next endpoint is not tried
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: refused.URL, Retry: &NoRetry})
+	client.endpoints = []string{refused.URL, unreachable.URL}
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err == nil || strings.Contains(err.Error(), unreachable.URL) {
+		t.Errorf("GetMetadata() = %v, want only the refused endpoint's error", err)
+	}
+	if probes.Load() != 0 {
+		t.Errorf("%v probes of the next endpoint after a refused connection", probes.Load())
+	}
+
+	// both errors are returned, and the failed selection is not probed again right away
+	client = NewIMDSClient(IMDSClientOptions{Endpoint: refused.URL, Retry: &NoRetry})
+	client.endpoints = []string{unreachable.URL, refused.URL}
+	_, err := client.GetMetadata(context.Background(), "instance-id")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, ErrNotDetected) || !strings.Contains(err.Error(), refused.URL) {
+		t.Errorf("GetMetadata() = %v, want the errors of both endpoints", err)
+	}
+	if _, again := client.GetMetadata(context.Background(), "instance-id"); again == nil || again.Error() != err.Error() || probes.Load() != 1 {
+		t.Errorf("GetMetadata() = %v after %v probes, want the cached selection error", again, probes.Load())
+	}
+}
+
+func TestIsUnreachable(t *testing.T) {
+	dial := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&MetadataError{Kind: ErrTimeout}, true},
+		{&MetadataError{Kind: ErrNotDetected, Err: dial(syscall.EHOSTUNREACH)}, true},
+		{dial(syscall.ENETUNREACH), true},
+		{&MetadataError{Kind: ErrNotDetected, Err: dial(syscall.ECONNREFUSED)}, false},
+		{&MetadataError{Kind: ErrNotDetected, Err: dial(syscall.ECONNRESET)}, false},
+		{&MetadataError{StatusCode: http.StatusNotFound, Kind: ErrNotDetected}, false},
+	} {
+		if got := IsUnreachable(test.err); got != test.want {
+			t.Errorf("IsUnreachable(%v) = %v", test.err, got)
+		}
+	}
+}
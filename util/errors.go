@@ -0,0 +1,112 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Re-exported by cloudprovider, they are defined here so the metadata clients can wrap them
+// without importing cloudprovider
+var (
+	ErrNotDetected   = errors.New("not running on this cloud provider")
+	ErrTimeout       = errors.New("metadata server timed out")
+	ErrUnauthorized  = errors.New("metadata request unauthorized")
+	ErrInvalidConfig = errors.New("invalid configuration")
+	ErrUnimplemented = errors.New("provider is not implemented")
+
+	ErrInvalidSignature     = errors.New("signature verification failed")
+	ErrUntrustedCertificate = errors.New("certificate is not trusted")
+	ErrAttestationMismatch  = errors.New("attested values do not match")
+)
+
+// A failed metadata server request, classified by one of the sentinel errors
+type MetadataError struct {
+	Method     string
+	URL        string
+	StatusCode int           // 0 if no response was received
+	Kind       error         // ErrNotDetected, ErrTimeout, ErrUnauthorized or nil if unclassified
+	Err        error         // the transport error, if any
+	RetryAfter time.Duration // the Retry-After header of the response, 0 if absent
+}
+
+func (e *MetadataError) Error() string {
+	msg := fmt.Sprintf(`%v %v`, e.Method, e.URL)
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf(`%v: %v %v`, msg, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf(`%v: %v`, msg, e.Err)
+	}
+	if e.Kind != nil {
+		msg = fmt.Sprintf(`%v (%v)`, msg, e.Kind)
+	}
+	return msg
+}
+
+func (e *MetadataError) Unwrap() (errs []error) {
+	for _, err := range []error{e.Kind, e.Err} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+// The request timed out or found no route to the host, the metadata server may still answer on
+// another address family. A refused or reset connection is an answer from a host without one
+func IsUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrTimeout) || errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)
+}
+
+// err of the first endpoint with the errors of the endpoints tried after it joined to its Err,
+// Kind stays that of the first endpoint
+func withFallbackErrors(err error, fallbacks ...error) error {
+	if len(fallbacks) == 0 {
+		return err
+	}
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) {
+		return errors.Join(append([]error{err}, fallbacks...)...)
+	}
+	joined := *metadataErr
+	joined.Err = errors.Join(append([]error{metadataErr.Err}, fallbacks...)...)
+	return &joined
+}
+
+// Classifies an error returned by http.Client.Do
+func NewRequestError(request *http.Request, err error) error {
+	var kind error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		kind = ErrTimeout
+	default:
+		// nothing listening, no route or no such host: there is no metadata server here
+		kind = ErrNotDetected
+	}
+	return &MetadataError{Method: request.Method, URL: request.URL.String(), Kind: kind, Err: err}
+}
+
+// Classifies a non 200 response
+func NewStatusError(request *http.Request, response *http.Response) error {
+	var kind error
+	switch response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		kind = ErrUnauthorized
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusBadRequest:
+		// another cloud's metadata server answering on the same link-local address
+		kind = ErrNotDetected
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		kind = ErrTimeout
+	}
+	return &MetadataError{Method: request.Method, URL: request.URL.String(), StatusCode: response.StatusCode, Kind: kind,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After"), time.Now())}
+}
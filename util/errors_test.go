@@ -0,0 +1,62 @@
+package util
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func doMetadataRequest(client *http.Client, url string) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return NewRequestError(request, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		return NewStatusError(request, response)
+	}
+	return nil
+}
+
+func TestMetadataErrorClassification(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	defer server.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	tests := []struct {
+		url  string
+		kind error
+	}{
+		{server.URL + "/unauthorized", ErrUnauthorized},
+		{server.URL + "/other-cloud", ErrNotDetected},
+		{server.URL + "/slow", ErrTimeout},
+		{closed.URL, ErrNotDetected},
+	}
+	for _, test := range tests {
+		err := doMetadataRequest(client, test.url)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%v: got %v, want %v", test.url, err, test.kind)
+		}
+		var metadataErr *MetadataError
+		if !errors.As(err, &metadataErr) || metadataErr.URL != test.url {
+			t.Errorf("%v: %v is not a *MetadataError for the request", test.url, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package util
+
+import (
+	"net/http"
+	"time"
+)
+
+const DefaultMetadataRequestTimeout = 2 * time.Second
+
+// Metadata servers are link-local and either answer fast or not at all,
+// so requests to them must never wait on http.DefaultClient's unbounded timeout
+var MetadataHTTPClient = &http.Client{Timeout: DefaultMetadataRequestTimeout}
@@ -0,0 +1,241 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultIMDSEndpoint = "http://169.254.169.254"
+	DefaultIMDSTokenTTL = 6 * time.Hour // the maximum IMDS accepts
+
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	imdsTokenMargin    = time.Minute // tokens are renewed this long before they expire
+	// A failed endpoint selection is returned without probing again for this long
+	imdsSelectionRetryInterval = 30 * time.Second
+)
+
+type IMDSClientOptions struct {
+	Endpoint     string        // without the /latest prefix, IMDSEndpoints selects it if empty
+	EndpointMode EndpointMode  // the address family to use when no endpoint is configured
+	TokenTTL     time.Duration // DefaultIMDSTokenTTL if zero, whole seconds
+	Retry        *RetryPolicy  // MetadataRetryPolicy if nil
+	// Fail instead of sending requests without a token when no IMDSv2 token can be obtained
+	DisableIMDSv1 bool
+}
+
+// EC2 instance metadata (IMDS) client. The IMDSv2 session token is cached and renewed before it
+// expires, a request rejected with 401 gets a new token and is sent once more.
+// When the token endpoint fails (IMDSv1 only, or the PUT exceeds the hop limit in a container)
+// requests are sent without a token until a 401 asks for one again.
+// In EndpointModeAuto the first request selects the first endpoint that answers. Safe for concurrent use
+type IMDSClient struct {
+	endpoints []string
+	err       error // invalid options, returned by every request
+	tokenTTL  time.Duration
+	retry     *RetryPolicy
+	allowV1   bool
+
+	endpointMutex sync.Mutex
+	endpoint      string    // the selected one of endpoints
+	selectErr     error     // why no endpoint answered
+	selectRetry   time.Time // when the endpoints are probed again after selectErr
+
+	mutex           sync.Mutex
+	token           string
+	tokenExpiration time.Time
+	v1              bool // no token could be obtained, requests are sent without one
+}
+
+func NewIMDSClient(opts IMDSClientOptions) *IMDSClient {
+	endpoints, err := IMDSEndpoints(opts.Endpoint, opts.EndpointMode)
+	if opts.TokenTTL < time.Second {
+		opts.TokenTTL = DefaultIMDSTokenTTL
+	}
+	return &IMDSClient{
+		endpoints: endpoints,
+		err:       err,
+		tokenTTL:  opts.TokenTTL,
+		retry:     opts.Retry,
+		allowV1:   !opts.DisableIMDSv1,
+	}
+}
+
+// The selected endpoint, the first candidate until one answered
+func (client *IMDSClient) Endpoint() string {
+	client.endpointMutex.Lock()
+	defer client.endpointMutex.Unlock()
+	if client.endpoint == "" && len(client.endpoints) > 0 {
+		return client.endpoints[0]
+	}
+	return client.endpoint
+}
+
+// Returns latest/<path>, e.g. dynamic/instance-identity/document. Failed requests return a *MetadataError
+func (client *IMDSClient) Get(ctx context.Context, path string) ([]byte, error) {
+	endpoint, err := client.selectEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.getToken(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.get(ctx, endpoint, path, token)
+	var metadataErr *MetadataError
+	if errors.As(err, &metadataErr) && metadataErr.StatusCode == http.StatusUnauthorized {
+		// the token expired or was invalidated, or IMDSv2 became required
+		client.InvalidateToken()
+		if token, err = client.getToken(ctx, endpoint); err != nil {
+			return nil, err
+		}
+		data, err = client.get(ctx, endpoint, path, token)
+	}
+	return data, err
+}
+
+// Returns latest/meta-data/<name>
+func (client *IMDSClient) GetMetadata(ctx context.Context, name string) (string, error) {
+	data, err := client.Get(ctx, "meta-data/"+name)
+	return string(data), err
+}
+
+// Drops the cached token, the next request gets a new one
+func (client *IMDSClient) InvalidateToken() {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.token = ""
+	client.v1 = false
+}
+
+// Returns the cached token or a new one, "" if requests are sent without a token
+func (client *IMDSClient) getToken(ctx context.Context, endpoint string) (string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.v1 {
+		return "", nil
+	}
+	if client.token != "" && time.Now().Before(client.tokenExpiration) {
+		return client.token, nil
+	}
+
+	requested := time.Now()
+	data, err := client.do(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPut, imdsURL(endpoint, "api/token"), nil)
+		if err == nil {
+			request.Header.Add(imdsTokenTTLHeader, strconv.Itoa(int(client.tokenTTL/time.Second)))
+		}
+		return request, err
+	})
+	if err != nil {
+		if !client.allowV1 || ctx.Err() != nil {
+			return "", err
+		}
+		client.v1 = true
+		return "", nil
+	}
+	client.token = string(data)
+	client.tokenExpiration = requested.Add(client.tokenTTL)
+	if client.tokenTTL > 2*imdsTokenMargin {
+		client.tokenExpiration = client.tokenExpiration.Add(-imdsTokenMargin)
+	}
+	return client.token, nil
+}
+
+func (client *IMDSClient) get(ctx context.Context, endpoint string, path string, token string) ([]byte, error) {
+	return client.do(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsURL(endpoint, path), nil)
+		if err == nil && token != "" {
+			request.Header.Add(imdsTokenHeader, token)
+		}
+		return request, err
+	})
+}
+
+// Sends the request until the retry policy gives up, returns the body of a 200 answer
+func (client *IMDSClient) do(ctx context.Context, newRequest func() (*http.Request, error)) (body []byte, err error) {
+	err = RetryPolicyOrDefault(client.retry).Do(ctx, func() (err error) {
+		body, err = doOnce(newRequest)
+		return
+	})
+	return
+}
+
+func doOnce(newRequest func() (*http.Request, error)) ([]byte, error) {
+	request, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	response, err := MetadataHTTPClient.Do(request)
+	if err != nil {
+		return nil, NewRequestError(request, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, NewStatusError(request, response)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// Returns the endpoint to send requests to, probing the candidates in order until one answers.
+// The next candidate is only tried when the previous one is unreachable (see IsUnreachable),
+// the error holds the errors of all candidates tried
+func (client *IMDSClient) selectEndpoint(ctx context.Context) (string, error) {
+	if client.err != nil {
+		return "", client.err
+	}
+	if len(client.endpoints) == 1 {
+		return client.endpoints[0], nil
+	}
+	client.endpointMutex.Lock()
+	defer client.endpointMutex.Unlock()
+	if client.endpoint != "" {
+		return client.endpoint, nil
+	}
+	if client.selectErr != nil && time.Now().Before(client.selectRetry) {
+		return "", client.selectErr
+	}
+	var errs []error
+	for _, endpoint := range client.endpoints {
+		err := probeIMDSEndpoint(ctx, endpoint)
+		if err == nil {
+			client.endpoint, client.selectErr = endpoint, nil
+			return endpoint, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil || !IsUnreachable(err) {
+			break
+		}
+	}
+	err := withFallbackErrors(errs[0], errs[1:]...)
+	if ctx.Err() == nil {
+		// a cancelled probe says nothing about the endpoints
+		client.selectErr, client.selectRetry = err, time.Now().Add(imdsSelectionRetryInterval)
+	}
+	return "", err
+}
+
+// Any answer, even 401 or 404, shows the endpoint is reachable
+func probeIMDSEndpoint(ctx context.Context, endpoint string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsURL(endpoint, ""), nil)
+	if err != nil {
+		return err
+	}
+	response, err := MetadataHTTPClient.Do(request)
+	if err != nil {
+		return NewRequestError(request, err)
+	}
+	response.Body.Close()
+	return nil
+}
+
+func imdsURL(endpoint string, path string) string {
+	return fmt.Sprintf(`%v/latest/%v`, endpoint, path)
+}
@@ -0,0 +1,156 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// IMDS stand-in. tokens: IMDSv2 tokens are issued and required, otherwise the token endpoint is missing
+type testIMDS struct {
+	mutex       sync.Mutex
+	tokens      bool
+	token       string
+	issued      int
+	requests    int
+	failures    int // answer the next requests with 500
+	unsupported int // requests without a valid token while tokens are required
+}
+
+func (imds *testIMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	imds.mutex.Lock()
+	defer imds.mutex.Unlock()
+	imds.requests++
+	if imds.failures > 0 {
+		imds.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Path == "/latest/api/token" {
+		if !imds.tokens {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPut || r.Header.Get(imdsTokenTTLHeader) != "21600" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		imds.issued++
+		imds.token = fmt.Sprintf("token-%v", imds.issued)
+		w.Write([]byte(imds.token))
+		return
+	}
+	if imds.tokens && r.Header.Get(imdsTokenHeader) != imds.token {
+		imds.unsupported++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/latest/meta-data/instance-id":
+		w.Write([]byte("i-0123456789abcdef0"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html>404 - Not Found</html>"))
+	}
+}
+
+func newTestIMDS(t *testing.T, tokens bool) (*testIMDS, *httptest.Server) {
+	imds := &testIMDS{tokens: tokens}
+	server := httptest.NewServer(imds)
+	t.Cleanup(server.Close)
+	return imds, server
+}
+
+func TestIMDSClientToken(t *testing.T) {
+	imds, server := newTestIMDS(t, true)
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL})
+
+	for i := 0; i < 3; i++ {
+		id, err := client.GetMetadata(context.Background(), "instance-id")
+		if err != nil || id != "i-0123456789abcdef0" {
+			t.Fatalf("GetMetadata() = %q, %v", id, err)
+		}
+	}
+	if imds.issued != 1 || imds.unsupported != 0 {
+		t.Errorf("%v tokens issued, %v requests rejected, want the token to be cached", imds.issued, imds.unsupported)
+	}
+
+	// the server forgot the token, e.g. after the instance was stopped and started
+	imds.token = "rotated"
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err != nil {
+		t.Fatal(err)
+	}
+	if imds.issued != 2 {
+		t.Errorf("%v tokens issued, want the rejected token to be renewed", imds.issued)
+	}
+}
+
+func TestIMDSClientStatus(t *testing.T) {
+	_, server := newTestIMDS(t, true)
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL})
+
+	// the error page must not be returned as the value
+	data, err := client.Get(context.Background(), "meta-data/missing")
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) || metadataErr.StatusCode != http.StatusNotFound || data != nil {
+		t.Errorf("Get() = %q, %v", data, err)
+	}
+}
+
+func TestIMDSClientRetries(t *testing.T) {
+	imds, server := newTestIMDS(t, true)
+	imds.failures = 2
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL})
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err != nil {
+		t.Fatalf("failures within the attempts: %v", err)
+	}
+
+	imds.failures = 3
+	client = NewIMDSClient(IMDSClientOptions{Endpoint: server.URL, Retry: &RetryPolicy{MaxAttempts: 2}, DisableIMDSv1: true})
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err == nil {
+		t.Error("more failures than attempts")
+	}
+}
+
+func TestIMDSClientFallback(t *testing.T) {
+	imds, server := newTestIMDS(t, false)
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL})
+	for i := 0; i < 2; i++ {
+		if id, err := client.GetMetadata(context.Background(), "instance-id"); err != nil || id != "i-0123456789abcdef0" {
+			t.Fatalf("IMDSv1: %q, %v", id, err)
+		}
+	}
+	if imds.requests != 3 {
+		t.Errorf("%v requests, want the token endpoint to be tried once", imds.requests)
+	}
+
+	// IMDSv2 became required
+	imds.tokens = true
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err != nil {
+		t.Errorf("after IMDSv2 was enabled: %v", err)
+	}
+
+	_, server = newTestIMDS(t, false)
+	client = NewIMDSClient(IMDSClientOptions{Endpoint: server.URL, DisableIMDSv1: true})
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); !errors.Is(err, ErrNotDetected) {
+		t.Errorf("IMDSv1 disabled: %v", err)
+	}
+}
+
+func TestEC2MetadataClient(t *testing.T) {
+	_, server := newTestIMDS(t, true)
+	client := New(21600)
+	client.imds.endpoints = []string{server.URL}
+
+	id, err := client.GetEC2InstanceIDWithRetry(2)
+	if err != nil || id != "i-0123456789abcdef0" {
+		t.Errorf("GetEC2InstanceIDWithRetry() = %q, %v", id, err)
+	}
+	if _, err = client.GetEC2Metadata(); err == nil {
+		t.Error("GetEC2Metadata() parsed an error page")
+	}
+}
@@ -0,0 +1,166 @@
+package pkcs7
+
+import (
+	"errors"
+)
+
+var errTruncated = errors.New("ber: truncated")
+
+// Azure signs with an encoder that uses BER indefinite lengths and constructed strings,
+// encoding/asn1 only parses DER
+func berToDER(data []byte) ([]byte, error) {
+	der, rest, err := convertElement(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("ber: trailing data")
+	}
+	return der, nil
+}
+
+const maxDepth = 32
+
+// Converts one element, returns its DER encoding and the data following it
+func convertElement(data []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, errors.New("ber: nested too deep")
+	}
+	tag, rest, err := readTag(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	constructed := tag[0]&0x20 != 0
+	if len(rest) == 0 {
+		return nil, nil, errTruncated
+	}
+
+	var contents []byte
+	if rest[0] == 0x80 {
+		// indefinite length, the contents end with 00 00
+		if !constructed {
+			return nil, nil, errors.New("ber: indefinite length primitive")
+		}
+		rest = rest[1:]
+		for {
+			if len(rest) < 2 {
+				return nil, nil, errTruncated
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			var child []byte
+			if child, rest, err = convertElement(rest, depth+1); err != nil {
+				return nil, nil, err
+			}
+			contents = append(contents, child...)
+		}
+	} else {
+		length, tail, err := readLength(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if length > len(tail) {
+			return nil, nil, errTruncated
+		}
+		contents, rest = tail[:length], tail[length:]
+		if constructed {
+			var converted []byte
+			for children := contents; len(children) > 0; {
+				var child []byte
+				if child, children, err = convertElement(children, depth+1); err != nil {
+					return nil, nil, err
+				}
+				converted = append(converted, child...)
+			}
+			contents = converted
+		}
+	}
+
+	if constructed && tag[0] == 0x24 {
+		// constructed OCTET STRING, DER holds the concatenated segments in a primitive one
+		if contents, err = concatSegments(contents); err != nil {
+			return nil, nil, err
+		}
+		tag = []byte{0x04}
+	}
+
+	der := append(append([]byte{}, tag...), encodeLength(len(contents))...)
+	return append(der, contents...), rest, nil
+}
+
+// The segments were already converted, they are primitive OCTET STRINGs
+func concatSegments(contents []byte) ([]byte, error) {
+	result := []byte{}
+	for len(contents) > 0 {
+		if contents[0] != 0x04 {
+			return nil, errors.New("ber: invalid OCTET STRING segment")
+		}
+		length, tail, err := readLength(contents[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length > len(tail) {
+			return nil, errTruncated
+		}
+		result = append(result, tail[:length]...)
+		contents = tail[length:]
+	}
+	return result, nil
+}
+
+func readTag(data []byte) ([]byte, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	n := 1
+	if data[0]&0x1f == 0x1f {
+		// high tag number, base 128 continued while the top bit is set
+		for {
+			if n >= len(data) {
+				return nil, nil, errTruncated
+			}
+			n++
+			if data[n-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	return data[:n], data[n:], nil
+}
+
+func readLength(data []byte) (int, []byte, error) {
+	if len(data) == 0 {
+		return 0, nil, errTruncated
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), data[1:], nil
+	}
+	n := int(data[0] & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, nil, errors.New("ber: unsupported length")
+	}
+	if len(data) < n+1 {
+		return 0, nil, errTruncated
+	}
+	length := 0
+	for _, b := range data[1 : n+1] {
+		length = length<<8 | int(b)
+	}
+	if length < 0 {
+		return 0, nil, errors.New("ber: unsupported length")
+	}
+	return length, data[n+1:], nil
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	encoded := []byte{}
+	for l := length; l > 0; l >>= 8 {
+		encoded = append([]byte{byte(l)}, encoded...)
+	}
+	return append([]byte{0x80 | byte(len(encoded))}, encoded...)
+}
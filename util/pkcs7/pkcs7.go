@@ -0,0 +1,322 @@
+// Minimal PKCS #7 / CMS SignedData support, enough to verify the signed documents of the
+// cloud metadata servers (Azure attested data) without an external dependency
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	oidSHA1.String():   crypto.SHA1,
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+var signatureAlgorithms = map[crypto.Hash][2]x509.SignatureAlgorithm{
+	crypto.SHA1:   {x509.SHA1WithRSA, x509.ECDSAWithSHA1},
+	crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+	crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+	crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+// A parsed SignedData message
+type SignedData struct {
+	Content      []byte
+	Certificates []*x509.Certificate // as embedded in the message, the chain may be incomplete
+	signers      []signerInfo
+}
+
+// Parses a DER or BER encoded ContentInfo holding SignedData with embedded content
+func Parse(data []byte) (*SignedData, error) {
+	der, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs7: %w", err)
+	}
+	var info contentInfo
+	if _, err = asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("pkcs7: %w", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("pkcs7: unsupported content type %v", info.ContentType)
+	}
+	var sd signedData
+	if _, err = asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("pkcs7: signed data: %w", err)
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidData) {
+		return nil, fmt.Errorf("pkcs7: unsupported signed content type %v", sd.ContentInfo.ContentType)
+	}
+
+	result := &SignedData{signers: sd.SignerInfos}
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		if _, err = asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &result.Content); err != nil {
+			return nil, fmt.Errorf("pkcs7: content: %w", err)
+		}
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		if result.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("pkcs7: certificates: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// Verifies the signature of every signer over the content and returns the signing certificates.
+// The certificates themselves are not verified, see VerifyChain
+func (sd *SignedData) Verify() ([]*x509.Certificate, error) {
+	if len(sd.signers) == 0 {
+		return nil, fmt.Errorf("pkcs7: no signers: %w", util.ErrInvalidSignature)
+	}
+	signers := []*x509.Certificate{}
+	for i := range sd.signers {
+		certificate, err := sd.verifySigner(&sd.signers[i])
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, certificate)
+	}
+	return signers, nil
+}
+
+// Verifies the signatures and the chain of each signing certificate.
+// The embedded certificates are added to opts.Intermediates
+func (sd *SignedData) VerifyChain(opts x509.VerifyOptions) ([]*x509.Certificate, error) {
+	signers, err := sd.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, certificate := range sd.Certificates {
+		opts.Intermediates.AddCert(certificate)
+	}
+	for _, signer := range signers {
+		if _, err = signer.Verify(opts); err != nil {
+			return nil, fmt.Errorf("pkcs7: signer %v: %w: %v", signer.Subject, util.ErrUntrustedCertificate, err)
+		}
+	}
+	return signers, nil
+}
+
+func (sd *SignedData) verifySigner(signer *signerInfo) (*x509.Certificate, error) {
+	certificate := sd.findCertificate(&signer.IssuerAndSerialNumber)
+	if certificate == nil {
+		return nil, fmt.Errorf("pkcs7: signing certificate %v is not embedded: %w", signer.IssuerAndSerialNumber.SerialNumber, util.ErrUntrustedCertificate)
+	}
+	hash, ok := digestAlgorithms[signer.DigestAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return nil, fmt.Errorf("pkcs7: unsupported digest algorithm %v", signer.DigestAlgorithm.Algorithm)
+	}
+
+	signed := sd.Content
+	if len(signer.AuthenticatedAttributes.Bytes) > 0 {
+		// the signature covers the attributes, which hold the digest and the type of the content
+		digest, contentType, err := signedAttributes(signer.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if !contentType.Equal(oidData) {
+			return nil, fmt.Errorf("pkcs7: signed content type %v: %w", contentType, util.ErrInvalidSignature)
+		}
+		h := hash.New()
+		h.Write(sd.Content)
+		if !bytes.Equal(digest, h.Sum(nil)) {
+			return nil, fmt.Errorf("pkcs7: content digest mismatch: %w", util.ErrInvalidSignature)
+		}
+		// signed as SET OF, encoded as [0] IMPLICIT
+		signed = append([]byte{0x31}, signer.AuthenticatedAttributes.FullBytes[1:]...)
+	}
+
+	algorithms := signatureAlgorithms[hash]
+	algorithm := algorithms[0]
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); ok {
+		algorithm = algorithms[1]
+	}
+	if err := certificate.CheckSignature(algorithm, signed, signer.EncryptedDigest); err != nil {
+		return nil, fmt.Errorf("pkcs7: %w: %v", util.ErrInvalidSignature, err)
+	}
+	return certificate, nil
+}
+
+func (sd *SignedData) findCertificate(id *issuerAndSerial) *x509.Certificate {
+	for _, certificate := range sd.Certificates {
+		if certificate.SerialNumber.Cmp(id.SerialNumber) == 0 && bytes.Equal(certificate.RawIssuer, id.IssuerName.FullBytes) {
+			return certificate
+		}
+	}
+	return nil
+}
+
+// The message digest and content type attributes, both are required (RFC 5652 section 5.3)
+func signedAttributes(attributes []byte) (digest []byte, contentType asn1.ObjectIdentifier, err error) {
+	for rest := attributes; len(rest) > 0; {
+		var attr attribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, nil, fmt.Errorf("pkcs7: attributes: %w", err)
+		}
+		switch {
+		case attr.Type.Equal(oidMessageDigest) && digest == nil:
+			if _, err = asn1.Unmarshal(attr.Value.Bytes, &digest); err != nil {
+				return nil, nil, fmt.Errorf("pkcs7: message digest: %w", err)
+			}
+		case attr.Type.Equal(oidContentType) && contentType == nil:
+			if _, err = asn1.Unmarshal(attr.Value.Bytes, &contentType); err != nil {
+				return nil, nil, fmt.Errorf("pkcs7: content type: %w", err)
+			}
+		case attr.Type.Equal(oidMessageDigest), attr.Type.Equal(oidContentType):
+			return nil, nil, fmt.Errorf("pkcs7: repeated %v attribute: %w", attr.Type, util.ErrInvalidSignature)
+		}
+	}
+	if digest == nil {
+		return nil, nil, fmt.Errorf("pkcs7: no message digest attribute: %w", util.ErrInvalidSignature)
+	}
+	if contentType == nil {
+		return nil, nil, fmt.Errorf("pkcs7: no content type attribute: %w", util.ErrInvalidSignature)
+	}
+	return digest, contentType, nil
+}
+
+// Creates a DER encoded SignedData of content with a SHA-256 signature over signed attributes.
+// Used to produce test documents, the extra certificates are embedded after the signer's
+func Sign(content []byte, certificate *x509.Certificate, key crypto.Signer, extra ...*x509.Certificate) ([]byte, error) {
+	return sign(content, oidData, certificate, key, extra...)
+}
+
+// contentType is the signed content type attribute, tests use it to produce mismatching documents
+func sign(content []byte, contentType asn1.ObjectIdentifier, certificate *x509.Certificate, key crypto.Signer, extra ...*x509.Certificate) ([]byte, error) {
+	digest := crypto.SHA256.New()
+	digest.Write(content)
+
+	contentTypeValue, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, err
+	}
+	digestValue, err := asn1.Marshal(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	encodedAttributes, err := asn1.Marshal([]attribute{
+		{Type: oidContentType, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: contentTypeValue}},
+		{Type: oidMessageDigest, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: digestValue}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var attributes asn1.RawValue
+	if _, err = asn1.Unmarshal(encodedAttributes, &attributes); err != nil {
+		return nil, err
+	}
+	// asn1 encodes the slice as SEQUENCE, the signature is over SET OF
+	attributesDigest := crypto.SHA256.New()
+	attributesDigest.Write(append([]byte{0x31}, encodedAttributes[1:]...))
+
+	var algorithm asn1.ObjectIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm = oidRSAEncryption
+	case *ecdsa.PublicKey:
+		algorithm = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2} // ecdsa-with-SHA256
+	default:
+		return nil, errors.New("pkcs7: unsupported key type")
+	}
+	signature, err := key.Sign(rand.Reader, attributesDigest.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	var certificates []byte
+	for _, c := range append([]*x509.Certificate{certificate}, extra...) {
+		certificates = append(certificates, c.Raw...)
+	}
+	encodedContent, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo: contentInfo{
+			ContentType: oidData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encodedContent},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     issuerAndSerial{IssuerName: asn1.RawValue{FullBytes: certificate.RawIssuer}, SerialNumber: certificate.SerialNumber},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes.Bytes},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: algorithm},
+			EncryptedDigest:           signature,
+		}},
+	}
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
@@ -0,0 +1,308 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/VolumezTech/volumez-cloud-provider/util"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+}
+
+func newTestCertificate(t testing.TB, name string, parent *testCertificate, key crypto.Signer, isCA bool) *testCertificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:              []string{name},
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func newRSAKey(t testing.TB) crypto.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECDSAKey(t testing.TB) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSignVerify(t *testing.T) {
+	ca := newTestCertificate(t, "ca", nil, newRSAKey(t), true)
+	content := []byte(`{"vmId":"1234"}`)
+
+	for name, key := range map[string]crypto.Signer{"rsa": newRSAKey(t), "ecdsa": newECDSAKey(t)} {
+		t.Run(name, func(t *testing.T) {
+			signer := newTestCertificate(t, "metadata.example.com", ca, key, false)
+			data, err := Sign(content, signer.certificate, signer.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sd, err := Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sd.Content, content) {
+				t.Errorf("content: %q", sd.Content)
+			}
+			signers, err := sd.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(signers) != 1 || !signers[0].Equal(signer.certificate) {
+				t.Errorf("signers: %v", signers)
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.certificate)
+			if _, err = sd.VerifyChain(x509.VerifyOptions{Roots: roots, DNSName: "metadata.example.com"}); err != nil {
+				t.Error(err)
+			}
+			if _, err = sd.VerifyChain(x509.VerifyOptions{Roots: x509.NewCertPool()}); !errors.Is(err, util.ErrUntrustedCertificate) {
+				t.Errorf("unknown root: %v", err)
+			}
+			if _, err = sd.VerifyChain(x509.VerifyOptions{Roots: roots, DNSName: "other.example.com"}); !errors.Is(err, util.ErrUntrustedCertificate) {
+				t.Errorf("wrong name: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIntermediate(t *testing.T) {
+	ca := newTestCertificate(t, "ca", nil, newRSAKey(t), true)
+	intermediate := newTestCertificate(t, "intermediate", ca, newRSAKey(t), true)
+	signer := newTestCertificate(t, "signer", intermediate, newRSAKey(t), false)
+
+	data, err := Sign([]byte("content"), signer.certificate, signer.key, intermediate.certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.Certificates) != 2 {
+		t.Fatalf("certificates: %v", len(sd.Certificates))
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	if _, err = sd.VerifyChain(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	signer := newTestCertificate(t, "signer", nil, newRSAKey(t), false)
+	data, err := Sign([]byte("content"), signer.certificate, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.Content = []byte("Content")
+	if _, err = sd.Verify(); !errors.Is(err, util.ErrInvalidSignature) {
+		t.Errorf("modified content: %v", err)
+	}
+
+	sd, _ = Parse(data)
+	signature := sd.signers[0].EncryptedDigest
+	signature[len(signature)-1] ^= 1
+	if _, err = sd.Verify(); !errors.Is(err, util.ErrInvalidSignature) {
+		t.Errorf("modified signature: %v", err)
+	}
+
+	other := newTestCertificate(t, "signer", nil, newRSAKey(t), false)
+	sd, _ = Parse(data)
+	sd.Certificates = []*x509.Certificate{other.certificate}
+	if _, err = sd.Verify(); !errors.Is(err, util.ErrUntrustedCertificate) {
+		t.Errorf("missing certificate: %v", err)
+	}
+
+	if _, err = Parse([]byte("not pkcs7")); err == nil {
+		t.Error("parsed garbage")
+	}
+}
+
+func TestVerifyContentType(t *testing.T) {
+	signer := newTestCertificate(t, "signer", nil, newRSAKey(t), false)
+	data, err := sign([]byte("content"), oidSignedData, signer.certificate, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sd.Verify(); !errors.Is(err, util.ErrInvalidSignature) {
+		t.Errorf("signed content type is not data: %v", err)
+	}
+
+	for name, attributes := range map[string][]attribute{
+		"missing content type":   {{Type: oidMessageDigest}},
+		"missing message digest": {{Type: oidContentType}},
+		"repeated content type":  {{Type: oidContentType}, {Type: oidContentType}},
+	} {
+		var encoded []byte
+		for _, attr := range attributes {
+			value, _ := asn1.Marshal(oidData)
+			if attr.Type.Equal(oidMessageDigest) {
+				value, _ = asn1.Marshal([]byte{1, 2, 3})
+			}
+			attr.Value = asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}
+			element, err := asn1.Marshal(attr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded = append(encoded, element...)
+		}
+		if _, _, err := signedAttributes(encoded); !errors.Is(err, util.ErrInvalidSignature) {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	tests := []struct {
+		name     string
+		ber, der []byte
+	}{
+		{"definite", []byte{0x30, 0x03, 0x02, 0x01, 0x05}, []byte{0x30, 0x03, 0x02, 0x01, 0x05}},
+		{"indefinite", []byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00}, []byte{0x30, 0x03, 0x02, 0x01, 0x05}},
+		{"nested indefinite",
+			[]byte{0x30, 0x80, 0xa0, 0x80, 0x04, 0x01, 0x61, 0x00, 0x00, 0x00, 0x00},
+			[]byte{0x30, 0x05, 0xa0, 0x03, 0x04, 0x01, 0x61}},
+		{"constructed octet string",
+			[]byte{0x24, 0x80, 0x04, 0x01, 0x61, 0x04, 0x02, 0x62, 0x63, 0x00, 0x00},
+			[]byte{0x04, 0x03, 0x61, 0x62, 0x63}},
+	}
+	for _, test := range tests {
+		der, err := berToDER(test.ber)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(der, test.der) {
+			t.Errorf("%v: % x, expected % x", test.name, der, test.der)
+		}
+	}
+
+	for _, ber := range [][]byte{{0x30, 0x80, 0x02, 0x01, 0x05}, {0x30, 0x05, 0x02}, {0x04, 0x80, 0x00, 0x00}, {0x02, 0x01, 0x05, 0x00}} {
+		if _, err := berToDER(ber); err == nil {
+			t.Errorf("% x: expected an error", ber)
+		}
+	}
+}
+
+func TestParseBER(t *testing.T) {
+	signer := newTestCertificate(t, "signer", nil, newRSAKey(t), false)
+	content := bytes.Repeat([]byte("x"), 300)
+	data, err := Sign(content, signer.certificate, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// re-encode the outer ContentInfo with an indefinite length, as some signers do
+	_, rest, err := readTag(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, contents, err := readLength(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ber := append(append([]byte{0x30, 0x80}, contents...), 0x00, 0x00)
+
+	sd, err := Parse(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sd.Content, content) {
+		t.Error("content differs")
+	}
+	if _, err = sd.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzBerToDER(f *testing.F) {
+	for _, seed := range [][]byte{
+		{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00},
+		{0x30, 0x80, 0xa0, 0x80, 0x04, 0x01, 0x61, 0x00, 0x00, 0x00, 0x00},
+		{0x24, 0x80, 0x04, 0x01, 0x61, 0x24, 0x03, 0x04, 0x01, 0x62, 0x00, 0x00},
+		{0x30, 0x81, 0x03, 0x02, 0x01, 0x05},
+		{0x3f, 0x81, 0x01, 0x80, 0x00, 0x00},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, ber []byte) {
+		der, err := berToDER(ber)
+		if err != nil {
+			return
+		}
+		// DER is already converted
+		again, err := berToDER(der)
+		if err != nil || !bytes.Equal(again, der) {
+			t.Errorf("% x -> % x -> % x, %v", ber, der, again, err)
+		}
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	signer := newTestCertificate(f, "signer", nil, newECDSAKey(f), false)
+	data, err := Sign([]byte(`{"vmId":"1234"}`), signer.certificate, signer.key)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	_, rest, _ := readTag(data)
+	_, contents, _ := readLength(rest)
+	f.Add(append(append([]byte{0x30, 0x80}, contents...), 0x00, 0x00))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sd, err := Parse(data)
+		if err != nil {
+			return
+		}
+		sd.Verify()
+	})
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When and how long to wait before a failed metadata request is sent again
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first one, 1 or less disables retries
+	BaseDelay   time.Duration // delay before the first retry, doubled for every further one
+	MaxDelay    time.Duration // upper bound of a single backoff delay, 0 for no bound
+	Jitter      float64       // delays are shortened by a random fraction of up to Jitter, 0 to 1
+	// Answers that are retried. Transport errors are retried too, unless nothing is listening
+	RetryableStatusCodes []int
+	// No retry is started once it would wait past Budget since the first attempt, 0 for no limit
+	Budget time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          3,
+	BaseDelay:            100 * time.Millisecond,
+	MaxDelay:             2 * time.Second,
+	Jitter:               0.2,
+	RetryableStatusCodes: []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	Budget:               10 * time.Second,
+}
+
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// Used by every metadata client that is not given its own policy. The probes read it concurrently,
+// do not change it while clients are in use, pass a Retry option to the clients instead
+var MetadataRetryPolicy = DefaultRetryPolicy
+
+// policy, MetadataRetryPolicy if nil
+func RetryPolicyOrDefault(policy *RetryPolicy) RetryPolicy {
+	if policy == nil {
+		return MetadataRetryPolicy
+	}
+	return *policy
+}
+
+// Calls op until it succeeds, fails with an error that is not retryable, or the attempts, the budget
+// or ctx run out. Returns the last error of op. A Retry-After answer replaces the backoff delay
+func (policy RetryPolicy) Do(ctx context.Context, op func() error) error {
+	var deadline time.Time
+	if policy.Budget > 0 {
+		deadline = time.Now().Add(policy.Budget)
+	}
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			return err
+		}
+		delay := policy.Backoff(attempt)
+		var metadataErr *MetadataError
+		if errors.As(err, &metadataErr) && metadataErr.RetryAfter > 0 {
+			delay = metadataErr.RetryAfter
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Transport errors other than ErrNotDetected and answers with one of RetryableStatusCodes
+func (policy RetryPolicy) Retryable(err error) bool {
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if metadataErr.StatusCode == 0 {
+		return metadataErr.Kind != ErrNotDetected
+	}
+	for _, code := range policy.RetryableStatusCodes {
+		if code == metadataErr.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// The delay before the retry-th retry, 1 for the first one
+func (policy RetryPolicy) Backoff(retry int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < retry && delay < math.MaxInt64/2 && (policy.MaxDelay <= 0 || delay < policy.MaxDelay); i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	jitter := policy.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay -= time.Duration(float64(delay) * jitter * rand.Float64())
+	}
+	return delay
+}
+
+// Retry-After is either delay-seconds or an HTTP date, 0 if missing or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
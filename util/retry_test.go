@@ -0,0 +1,141 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 100: time.Second} {
+		if delay := policy.Backoff(retry); delay != want {
+			t.Errorf("Backoff(%v) = %v, want %v", retry, delay, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.Backoff(3); delay < 200*time.Millisecond || delay > 400*time.Millisecond {
+			t.Fatalf("Backoff(3) = %v with jitter", delay)
+		}
+	}
+	if delay := (RetryPolicy{BaseDelay: time.Second}).Backoff(200); delay <= 0 {
+		t.Errorf("unbounded Backoff(200) = %v", delay)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := DefaultRetryPolicy
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&MetadataError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&MetadataError{StatusCode: http.StatusTooManyRequests}, true},
+		{&MetadataError{StatusCode: http.StatusNotFound, Kind: ErrNotDetected}, false},
+		{&MetadataError{Kind: ErrTimeout}, true},
+		{&MetadataError{Kind: ErrNotDetected}, false},
+		{&MetadataError{Err: context.Canceled}, false},
+		{errors.New("invalid character"), false},
+	} {
+		if got := policy.Retryable(test.err); got != test.want {
+			t.Errorf("Retryable(%v) = %v", test.err, got)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}
+	calls := 0
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		return &MetadataError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("%v calls, %v, want all attempts to fail", calls, err)
+	}
+
+	calls = 0
+	policy.Do(context.Background(), func() error {
+		calls++
+		return &MetadataError{StatusCode: http.StatusNotFound}
+	})
+	if calls != 1 {
+		t.Errorf("%v calls, want answers that are not retryable to be returned", calls)
+	}
+
+	// Retry-After replaces the backoff delay, unless it exceeds the budget
+	calls = 0
+	start := time.Now()
+	policy.Do(context.Background(), func() error {
+		calls++
+		return &MetadataError{StatusCode: http.StatusServiceUnavailable, RetryAfter: 50 * time.Millisecond}
+	})
+	if elapsed := time.Since(start); calls != 3 || elapsed < 100*time.Millisecond {
+		t.Errorf("%v calls in %v, want Retry-After to be honored", calls, elapsed)
+	}
+	calls = 0
+	policy.Budget = time.Second
+	policy.Do(context.Background(), func() error {
+		calls++
+		return &MetadataError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Hour}
+	})
+	if calls != 1 {
+		t.Errorf("%v calls, want no retry past the budget", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	policy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, RetryableStatusCodes: []int{http.StatusServiceUnavailable}}
+	policy.Do(ctx, func() error {
+		calls++
+		return &MetadataError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if calls != 1 {
+		t.Errorf("%v calls, want ctx to stop the retries", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 10 Jan 2024 08:00:30 GMT": 30 * time.Second,
+		"Wed, 10 Jan 2024 07:00:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestIMDSClientRetryAfter(t *testing.T) {
+	throttled := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if throttled > 0 {
+			throttled--
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("i-0123456789abcdef0"))
+	}))
+	defer server.Close()
+	client := NewIMDSClient(IMDSClientOptions{Endpoint: server.URL, Retry: &DefaultRetryPolicy, DisableIMDSv1: true})
+
+	start := time.Now()
+	if _, err := client.GetMetadata(context.Background(), "instance-id"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the Retry-After delay", elapsed)
+	}
+}